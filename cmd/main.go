@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/unbeman/av-banner-task/internal/app"
 	"github.com/unbeman/av-banner-task/internal/config"
+	"github.com/unbeman/av-banner-task/internal/logging"
 )
 
 // @title Banner service
@@ -20,13 +23,30 @@ import (
 // @description Type "Bearer" followed by a space and JWT token.
 // @BasePath /
 func main() {
-	cfg, err := config.GetConfig()
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := runTokenCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := config.GetConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	if cfg.PrintConfig {
+		if err = cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	level, err := log.ParseLevel(cfg.LogLevel)
-	log.SetLevel(level)
+	if err = logging.Setup(cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatal(err)
+	}
 
 	ctx := context.Background()
 
@@ -35,24 +55,51 @@ func main() {
 		log.Fatal(err)
 	}
 
-	done := make(chan struct{}, 1)
-	// func waits signal to stop program
+	// func reloads JWT keys on SIGHUP
 	go func() {
-		exit := make(chan os.Signal, 1)
-		signal.Notify(
-			exit,
-			os.Interrupt,
-			syscall.SIGTERM,
-			syscall.SIGINT,
-			syscall.SIGQUIT,
-		)
-
-		sig := <-exit
-		log.Printf("Got signal '%v'\n", sig)
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
 
-		bannerApp.Stop()
-		done <- struct{}{}
+		for range reload {
+			log.Info("Got SIGHUP, reloading keys")
+			if err := bannerApp.ReloadKeys(ctx); err != nil {
+				log.Errorf("couldn't reload keys: %v", err)
+			}
+		}
 	}()
-	bannerApp.Run()
-	<-done
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- bannerApp.Run()
+	}()
+
+	exit := make(chan os.Signal, 1)
+	signal.Notify(
+		exit,
+		os.Interrupt,
+		syscall.SIGTERM,
+		syscall.SIGINT,
+		syscall.SIGQUIT,
+	)
+
+	exitCode := 0
+	// waits signal to stop program or failure of a server
+	select {
+	case sig := <-exit:
+		log.Printf("Got signal '%v'\n", sig)
+	case err := <-failed:
+		log.Errorf("couldn't run application: %v", err)
+		exitCode = 1
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, cfg.ShutdownTimeout)
+	defer cancel()
+	if err := bannerApp.Stop(stopCtx); err != nil {
+		log.Errorf("couldn't stop application gracefully: %v", err)
+		exitCode = 1
+	}
+	if exitCode != 0 {
+		cancel()
+		os.Exit(exitCode)
+	}
 }
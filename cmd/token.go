@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/unbeman/av-banner-task/internal/app"
+	"github.com/unbeman/av-banner-task/internal/config"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+// runTokenCommand prints token signed with keys from config, it's intended for development and testing.
+// Arguments after "--" are service flags, e.g. -config.
+// Usage: banner-service token -role owner -features 1,2 -teams promo -ttl 1h -- -config config.yaml
+func runTokenCommand(args []string) error {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	subject := flags.String("sub", "", "token subject")
+	role := flags.String("role", rbac.RoleUser, "role of token owner")
+	features := flags.String("features", "", "comma separated ids of features, banners of which can be managed; any if empty")
+	teams := flags.String("teams", "", "comma separated teams, features of which can be managed")
+	ttl := flags.Duration("ttl", 0, "token lifetime, JWT_TOKEN_TTL by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfig(flags.Args())
+	if err != nil {
+		return err
+	}
+	policy, err := app.NewPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	if !policy.HasRole(*role) {
+		return fmt.Errorf("unknown role %s", *role)
+	}
+	jwtManager, err := app.NewJWTManager(cfg)
+	if err != nil {
+		return err
+	}
+
+	claims := utils.UserClaims{
+		StandardClaims: jwt.StandardClaims{Subject: *subject},
+		Role:           *role,
+		Teams:          splitList(*teams),
+	}
+	for _, feature := range splitList(*features) {
+		featureId, err := strconv.Atoi(feature)
+		if err != nil {
+			return fmt.Errorf("invalid feature id %q", feature)
+		}
+		claims.Features = append(claims.Features, featureId)
+	}
+	if *ttl == 0 {
+		*ttl = jwtManager.TokenTTL()
+	}
+
+	token, err := jwtManager.GenerateWithClaims(claims, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, token)
+	fmt.Fprintf(os.Stderr, "expires at %s\n", time.Now().Add(*ttl).Format(time.RFC3339))
+	return nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
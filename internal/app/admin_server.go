@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// AdminServer serves service endpoints like metrics on a separate port, which is not exposed to clients.
+type AdminServer struct {
+	server *http.Server
+}
+
+func NewAdminServer(address string) *AdminServer {
+	router := chi.NewMux()
+	router.Handle("/metrics", promhttp.Handler())
+	return &AdminServer{
+		server: &http.Server{Handler: router, Addr: address},
+	}
+}
+
+func (a *AdminServer) GetAddress() string {
+	return a.server.Addr
+}
+
+func (a *AdminServer) Run() error {
+	log.Info("starting admin HTTP server")
+	if err := a.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("admin HTTP server stopped: %w", err)
+	}
+	return nil
+}
+
+func (a *AdminServer) Close(ctx context.Context) error {
+	err := a.server.Shutdown(ctx)
+	if err != nil {
+		a.server.Close()
+		err = fmt.Errorf("couldn't gracefully shutdown admin HTTP server: %w", err)
+	}
+	log.Info("admin http server closed")
+	return err
+}
@@ -2,43 +2,171 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/unbeman/av-banner-task/internal/config"
 	"github.com/unbeman/av-banner-task/internal/controller"
+	"github.com/unbeman/av-banner-task/internal/events"
+	"github.com/unbeman/av-banner-task/internal/handlers"
+	"github.com/unbeman/av-banner-task/internal/health"
+	"github.com/unbeman/av-banner-task/internal/rbac"
 	"github.com/unbeman/av-banner-task/internal/storage/pg"
 	"github.com/unbeman/av-banner-task/internal/storage/redis"
+	"github.com/unbeman/av-banner-task/internal/tracing"
 	"github.com/unbeman/av-banner-task/internal/utils"
+	"github.com/unbeman/av-banner-task/internal/webhook"
 )
 
 type BannerApplication struct {
-	database *pg.PGStorage
-	cache    *redis.RedisManager
-	server   *HTTPServer
+	database   *pg.PGStorage
+	cache      *redis.RedisManager
+	jwtManager *utils.JWTManager
+	server     *HTTPServer
+	grpcServer *GRPCServer
+	admin      *AdminServer // nil if admin server is disabled
+	dispatcher *webhook.Dispatcher
+	relay      *events.Relay // nil if events publishing is disabled
+	cleaner    *events.Cleaner
+	health     *health.Checker
+	controller *controller.Controller
+
+	cacheWarmUpOnStart bool
+	cacheWarmUpLimit   int
+	shutdownDelay      time.Duration
+
+	shutdownTracing func(context.Context) error // nil if tracing is disabled
 }
 
-func (s BannerApplication) Run() {
-	s.server.Run()
+// Run starts background workers and servers and blocks until one of the servers stops.
+// It returns an error if a server couldn't start or failed, Stop should be called anyway.
+func (s BannerApplication) Run() error {
+	if s.cacheWarmUpOnStart {
+		// прогрев идет в фоне, до его окончания промахи кэша обслуживает база
+		if err := s.controller.StartWarmUpCache(context.Background(), s.cacheWarmUpLimit); err != nil {
+			log.Errorf("couldn't start cache warm-up: %v", err)
+		}
+	}
+	go s.jwtManager.RunKeysRefresh()
+	go s.dispatcher.Run()
+	if s.relay != nil {
+		go s.relay.Run()
+	}
+	go s.cleaner.Run()
+
+	servers := []func() error{s.server.Run, s.grpcServer.Run}
+	if s.admin != nil {
+		servers = append(servers, s.admin.Run)
+	}
+	stopped := make(chan error, len(servers))
+	for _, run := range servers {
+		go func(run func() error) {
+			stopped <- run()
+		}(run)
+	}
+	// после Stop серверы завершаются без ошибки
+	return <-stopped
 }
 
-func (s BannerApplication) Stop() {
-	s.server.Close()
+// ReloadKeys reloads JWT signing and public keys and TLS certificate.
+func (s BannerApplication) ReloadKeys(ctx context.Context) error {
+	// ошибка одного из источников не мешает обновить остальные
+	return errors.Join(s.server.ReloadCertificate(), s.jwtManager.ReloadKeys(ctx))
+}
+
+// Stop gracefully stops the application, ctx limits draining of requests and stopping of background workers.
+// Stop continues after failed steps and returns all their errors.
+func (s BannerApplication) Stop(ctx context.Context) error {
+	var errs []error
+	// балансировщик перестает направлять запросы до закрытия серверов,
+	// пока он не заметил провал /readyz, новые запросы еще обслуживаются
+	s.health.SetShuttingDown()
+	select {
+	case <-time.After(s.shutdownDelay):
+	case <-ctx.Done():
+	}
+
+	// серверы закрываются первыми, чтобы активные запросы завершились до остановки хранилищ
+	errs = append(errs, s.server.Close(ctx), s.grpcServer.Close(ctx))
+	if s.admin != nil {
+		// метрики доступны, пока обрабатываются оставшиеся запросы
+		errs = append(errs, s.admin.Close(ctx))
+	}
+
+	// фоновые задачи используют хранилища
+	errs = append(errs, s.controller.Stop(ctx))
+	errs = append(errs, stopWorker(ctx, "JWT keys refresh", s.jwtManager.Stop))
+	errs = append(errs, stopWorker(ctx, "webhook dispatcher", s.dispatcher.Stop))
+	if s.relay != nil {
+		errs = append(errs, stopWorker(ctx, "events relay", s.relay.Stop))
+	}
+	errs = append(errs, stopWorker(ctx, "outbox cleaner", s.cleaner.Stop))
+
 	s.database.Shutdown()
-	s.cache.Shutdown()
+	errs = append(errs, s.cache.Shutdown())
+
+	if s.shutdownTracing != nil {
+		// отправляем оставшиеся спаны, даже если время на остановку уже вышло
+		tracingCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := s.shutdownTracing(tracingCtx); err != nil {
+			errs = append(errs, fmt.Errorf("couldn't shutdown tracing: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stopWorker waits for the background worker to stop until ctx is done.
+func stopWorker(ctx context.Context, name string, stop func()) error {
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("couldn't stop %s: %w", name, ctx.Err())
+	}
 }
 
 func GetBannerApplication(ctx context.Context, cfg config.Config) (*BannerApplication, error) {
+	// провайдер задается до создания хранилищ, чтобы их спаны не терялись
+	var shutdownTracing func(context.Context) error
+	if cfg.TracingExporter != "" {
+		var err error
+		shutdownTracing, err = tracing.Setup(ctx, tracing.Config{
+			Exporter:     cfg.TracingExporter,
+			OTLPEndpoint: cfg.TracingOTLPEndpoint,
+			SampleRatio:  cfg.TracingSampleRatio,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't setup application: %w", err)
+		}
+	}
+
 	pg, err := pg.NewPG(ctx, cfg.PostgreSqlDSN)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't setup application: %w", err)
 	}
 
-	redisManager, err := redis.NewRedisManager(cfg.RedisURl, cfg.RedisExpirationDuration)
+	redisManager, err := redis.NewRedisManager(
+		cfg.RedisURl,
+		cfg.RedisExpirationDuration,
+		redis.WithStaleExpiration(cfg.RedisStaleExpiration),
+		redis.WithCircuitBreaker(cfg.RedisBreakerThreshold, cfg.RedisBreakerCooldown),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't setup application: %w", err)
 	}
 
-	jwtManager, err := utils.NewJWTManager(cfg.JWTPrivateKey)
+	jwtManager, err := NewJWTManager(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't setup application: %w", err)
 	}
@@ -47,16 +175,179 @@ func GetBannerApplication(ctx context.Context, cfg config.Config) (*BannerApplic
 	if err != nil {
 		return nil, fmt.Errorf("couldn't setup application: %w", err)
 	}
+	// отозванные токены хранятся в базе, Redis мог потерять их при перезапуске
+	if err = ctrl.SyncRevokedTokens(ctx); err != nil {
+		log.Errorf("couldn't sync revoked tokens: %v", err)
+	}
+
+	policy, err := NewPolicy(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't setup application: %w", err)
+	}
+
+	checker := health.NewChecker(cfg.HealthCheckTimeout)
+	checker.Add("postgres", pg.Ping)
+	checker.Add("migrations", pg.CheckMigrations)
+	// при недоступном Redis баннеры отдаются из базы
+	checker.AddNonCritical("redis", redisManager.Ping)
+
+	handlerOpts := []handlers.HttpHandlerOption{handlers.WithHealthChecker(checker)}
+	var grpcHandlerOpts []handlers.GrpcHandlerOption
+	if cfg.RateLimitMode != "" {
+		limiter, err := newRateLimiter(cfg, redisManager)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't setup application: %w", err)
+		}
+		limits := map[string]handlers.RateLimit{
+			handlers.RateLimitIP:    handlers.RateLimit(cfg.RateLimitIP),
+			handlers.RateLimitUser:  handlers.RateLimit(cfg.RateLimitUser),
+			handlers.RateLimitAdmin: handlers.RateLimit(cfg.RateLimitAdmin),
+		}
+		handlerOpts = append(handlerOpts, handlers.WithRateLimiter(limiter, limits))
+		grpcHandlerOpts = append(grpcHandlerOpts, handlers.WithGrpcRateLimiter(limiter, limits))
+	}
+
+	if cfg.AuthTokenEndpoint {
+		log.Warn("token issuing endpoint POST /auth/token is enabled, it must not be used in production")
+		for _, role := range cfg.AuthTokenRoles {
+			if !policy.HasRole(role) {
+				return nil, fmt.Errorf("couldn't setup application: unknown role %s of issued tokens", role)
+			}
+		}
+		handlerOpts = append(handlerOpts, handlers.WithTokenIssuing(cfg.AuthTokenMaxTTL, cfg.AuthTokenRoles))
+	}
+
+	handlerOpts = append(handlerOpts, handlers.WithMaxBodySize(cfg.HTTPMaxBodySize))
+	hs, err := NewHTTPServer(ctrl, jwtManager, policy, HTTPServerConfig{
+		Address:           cfg.HTTPAddress,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		TLSCertFile:       cfg.TLSCertFile,
+		TLSKeyFile:        cfg.TLSKeyFile,
+		TLSWatchInterval:  cfg.TLSWatchInterval,
+	}, handlerOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't setup application: %w", err)
+	}
 
-	hs, err := NewHTTPServer(ctrl, jwtManager)
+	gs, err := NewGRPCServer(ctrl, jwtManager, policy, cfg.GRPCAddress, grpcHandlerOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't setup application: %w", err)
 	}
 
+	var admin *AdminServer
+	if cfg.AdminAddress != "" {
+		prometheus.MustRegister(pg, redisManager)
+		admin = NewAdminServer(cfg.AdminAddress)
+	}
+
+	dispatcher := webhook.NewDispatcher(pg, webhook.DispatcherConfig{
+		PollInterval: cfg.WebhookPollInterval,
+		Timeout:      cfg.WebhookTimeout,
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		BackoffBase:  cfg.WebhookBackoffBase,
+		BackoffMax:   cfg.WebhookBackoffMax,
+	})
+
+	var relay *events.Relay
+	if cfg.EventsPublisher != "" {
+		publisher, err := newEventsPublisher(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't setup application: %w", err)
+		}
+		relay = events.NewRelay(pg, publisher, cfg.EventsRelayInterval)
+	}
+	// без публикации в шину события не ждут отметки relay
+	cleaner := events.NewCleaner(pg, cfg.EventsOutboxRetention, relay != nil)
+
 	service := &BannerApplication{
-		database: pg,
-		cache:    redisManager,
-		server:   hs,
+		database:   pg,
+		cache:      redisManager,
+		jwtManager: jwtManager,
+		server:     hs,
+		grpcServer: gs,
+		admin:      admin,
+		dispatcher: dispatcher,
+		relay:      relay,
+		cleaner:    cleaner,
+		health:     checker,
+		controller: ctrl,
+
+		cacheWarmUpOnStart: cfg.CacheWarmUpOnStart,
+		cacheWarmUpLimit:   cfg.CacheWarmUpLimit,
+		shutdownDelay:      cfg.ShutdownDelay,
+
+		shutdownTracing: shutdownTracing,
 	}
 	return service, nil
 }
+
+// NewJWTManager returns JWT manager with keys and claims validation from config.
+func NewJWTManager(cfg config.Config) (*utils.JWTManager, error) {
+	return utils.NewJWTManager(
+		cfg.JWTPrivateKey,
+		utils.WithIssuer(cfg.JWTIssuer),
+		utils.WithAudience(cfg.JWTAudience),
+		utils.WithClockSkew(cfg.JWTClockSkew),
+		utils.WithTokenTTL(cfg.JWTTokenTTL),
+		utils.WithKeySources(newKeySources(cfg)...),
+		utils.WithKeysRefreshInterval(cfg.JWTKeysRefreshInterval),
+		utils.WithSigningKeysFile(cfg.JWTSigningKeysFile),
+		utils.WithKeysWatchInterval(cfg.JWTKeysWatchInterval),
+	)
+}
+
+// NewPolicy returns RBAC policy from config files, the default one if files are not set.
+func NewPolicy(cfg config.Config) (*rbac.Policy, error) {
+	policy := rbac.DefaultPolicy()
+	if cfg.RBACPolicyFile != "" {
+		var err error
+		policy, err = rbac.LoadPolicy(cfg.RBACPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RBACTeamFeaturesFile != "" {
+		teams, err := rbac.LoadTeamFeatures(cfg.RBACTeamFeaturesFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.SetTeamFeatures(teams)
+	}
+	return policy, nil
+}
+
+func newEventsPublisher(cfg config.Config) (events.Publisher, error) {
+	switch cfg.EventsPublisher {
+	case "kafka":
+		return events.NewKafkaPublisher(cfg.EventsKafkaBrokers, cfg.EventsKafkaTopic)
+	case "file":
+		return events.NewFilePublisher(cfg.EventsLogFile)
+	default:
+		return nil, fmt.Errorf("unknown events publisher %q", cfg.EventsPublisher)
+	}
+}
+
+func newRateLimiter(cfg config.Config, redisManager *redis.RedisManager) (handlers.RateLimiter, error) {
+	switch cfg.RateLimitMode {
+	case "memory":
+		return handlers.NewMemoryRateLimiter(), nil
+	case "redis":
+		return redis.NewRateLimiter(redisManager), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit mode %q", cfg.RateLimitMode)
+	}
+}
+
+func newKeySources(cfg config.Config) []utils.KeySource {
+	var sources []utils.KeySource
+	if len(cfg.JWTPublicKeyFiles) > 0 {
+		sources = append(sources, utils.NewPEMFilesSource(cfg.JWTPublicKeyFiles...))
+	}
+	if cfg.JWTJWKSURL != "" {
+		sources = append(sources, utils.NewJWKSSource(cfg.JWTJWKSURL, http.DefaultClient))
+	}
+	return sources
+}
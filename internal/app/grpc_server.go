@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/unbeman/av-banner-task/internal/controller"
+	"github.com/unbeman/av-banner-task/internal/handlers"
+	"github.com/unbeman/av-banner-task/internal/pb"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+type GRPCServer struct {
+	server  *grpc.Server
+	address string
+}
+
+func NewGRPCServer(ctrl *controller.Controller, jwtManager *utils.JWTManager, policy *rbac.Policy, address string, opts ...handlers.GrpcHandlerOption) (*GRPCServer, error) {
+	handler, err := handlers.NewGrpcHandler(ctrl, jwtManager, policy, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't setup gRPC server: %w", err)
+	}
+
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		handler.Logging,
+		handler.IPRateLimit,
+		handler.Authorization,
+		handler.RateLimit,
+	))
+	pb.RegisterBannerServiceServer(server, handler)
+
+	gs := &GRPCServer{
+		server:  server,
+		address: address,
+	}
+	return gs, nil
+}
+
+func (g *GRPCServer) GetAddress() string {
+	return g.address
+}
+
+func (g *GRPCServer) Run() error {
+	log.Info("starting gRPC server")
+	listener, err := net.Listen("tcp", g.address)
+	if err != nil {
+		return fmt.Errorf("couldn't listen gRPC address: %w", err)
+	}
+	// Serve возвращает ErrServerStopped, если сервер остановили до запуска
+	if err = g.server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("gRPC server stopped: %w", err)
+	}
+	return nil
+}
+
+// Close waits for active calls until ctx is done, then stops the server forcibly.
+func (g *GRPCServer) Close(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		g.server.GracefulStop()
+		close(stopped)
+	}()
+
+	var err error
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		// Stop обрывает активные вызовы, после чего GracefulStop тоже завершается
+		g.server.Stop()
+		<-stopped
+		err = fmt.Errorf("couldn't gracefully shutdown gRPC server: %w", ctx.Err())
+	}
+	log.Info("gRPC server closed")
+	return err
+}
@@ -2,32 +2,70 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/unbeman/av-banner-task/internal/controller"
 	"github.com/unbeman/av-banner-task/internal/handlers"
+	"github.com/unbeman/av-banner-task/internal/rbac"
 	"github.com/unbeman/av-banner-task/internal/utils"
 )
 
+type HTTPServerConfig struct {
+	Address           string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration // поток изменений баннеров снимает ограничение для себя
+	IdleTimeout       time.Duration
+	TLSCertFile       string // TLS включается, если заданы файлы сертификата и ключа
+	TLSKeyFile        string
+	TLSWatchInterval  time.Duration // как часто проверяются изменения файлов сертификата
+}
+
 type HTTPServer struct {
-	server *http.Server
+	server       *http.Server
+	certificates *utils.CertificateReloader // nil if TLS is disabled
 }
 
-func NewHTTPServer(ctrl *controller.Controller, jwtManager *utils.JWTManager) (*HTTPServer, error) {
-	handler, err := handlers.NewHttpHandler(ctrl, jwtManager)
+func NewHTTPServer(
+	ctrl *controller.Controller,
+	jwtManager *utils.JWTManager,
+	policy *rbac.Policy,
+	cfg HTTPServerConfig,
+	opts ...handlers.HttpHandlerOption,
+) (*HTTPServer, error) {
+	handler, err := handlers.NewHttpHandler(ctrl, jwtManager, policy, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't setup HTTP server: %w", err)
 	}
 
 	hs := &HTTPServer{
 		server: &http.Server{
-			Handler: handler,
-			Addr:    ":8080",
+			Handler:           handler,
+			Addr:              cfg.Address,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
 		},
 	}
+	// Shutdown не прерывает активные запросы, поэтому потоки изменений завершаются отдельно
+	hs.server.RegisterOnShutdown(handler.Shutdown)
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		hs.certificates, err = utils.NewCertificateReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSWatchInterval)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't setup HTTP server: %w", err)
+		}
+		hs.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: hs.certificates.GetCertificate,
+		}
+	}
 	return hs, nil
 }
 
@@ -39,12 +77,44 @@ func (h *HTTPServer) GetAddress() string {
 	return h.server.Addr
 }
 
-func (h *HTTPServer) Run() {
-	log.Info("starting HTTP server")
-	h.server.ListenAndServe()
+// ReloadCertificate reloads TLS certificate from files, it does nothing if TLS is disabled.
+func (h *HTTPServer) ReloadCertificate() error {
+	if h.certificates == nil {
+		return nil
+	}
+	return h.certificates.Reload()
 }
 
-func (h *HTTPServer) Close() {
+// Run serves HTTP requests until the server is closed.
+// It returns an error if the server couldn't start or failed, but not after Close.
+func (h *HTTPServer) Run() error {
+	var err error
+	if h.certificates != nil {
+		log.Info("starting HTTPS server")
+		go h.certificates.Run()
+		// сертификат берется из TLSConfig.GetCertificate
+		err = h.server.ListenAndServeTLS("", "")
+	} else {
+		log.Info("starting HTTP server")
+		err = h.server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("HTTP server stopped: %w", err)
+	}
+	return nil
+}
+
+// Close waits for active requests until ctx is done, then closes remaining connections.
+func (h *HTTPServer) Close(ctx context.Context) error {
+	err := h.server.Shutdown(ctx)
+	if err != nil {
+		// не дождались завершения запросов, обрываем соединения
+		h.server.Close()
+		err = fmt.Errorf("couldn't gracefully shutdown HTTP server: %w", err)
+	}
+	if h.certificates != nil {
+		h.certificates.Stop()
+	}
 	log.Info("http server closed")
-	h.server.Shutdown(context.TODO())
+	return err
 }
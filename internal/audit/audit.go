@@ -0,0 +1,22 @@
+package audit
+
+import "context"
+
+// Info identifies who made a change and within which request.
+type Info struct {
+	Actor     string // субъект токена или API-ключ
+	RequestId string
+}
+
+type infoKey struct{}
+
+// WithInfo returns context with audit info of the request.
+func WithInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// FromContext returns audit info of the request, empty if there is none.
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(infoKey{}).(Info)
+	return info
+}
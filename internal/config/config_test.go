@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConfigFromFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+redis_url: redis://localhost:6380/1
+redis_expiration_duration: 1m
+http_address: ":8000"
+rate_limit_user: "5:10"
+events_kafka_brokers: [kafka-1:9092, kafka-2:9092]
+`), 0o600))
+
+	// переменные окружения переопределяют файл, флаги - переменные окружения
+	t.Setenv("HTTP_ADDRESS", ":8001")
+	cfg, err := GetConfig([]string{"-config", path, "-http-read-timeout", "3s"})
+	require.NoError(t, err)
+	assert.Equal(t, "redis://localhost:6380/1", cfg.RedisURl)
+	assert.Equal(t, time.Minute, cfg.RedisExpirationDuration)
+	assert.Equal(t, ":8001", cfg.HTTPAddress)
+	assert.Equal(t, 3*time.Second, cfg.HTTPReadTimeout)
+	assert.Equal(t, RateLimit{Rate: 5, Burst: 10}, cfg.RateLimitUser)
+	assert.Equal(t, RateLimit{}, cfg.RateLimitIP)
+	assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, cfg.EventsKafkaBrokers)
+	assert.Equal(t, PostgreSqlDSNDefault, cfg.PostgreSqlDSN)
+
+	cfg, err = GetConfig([]string{"-config", path, "-http-address", ":8002"})
+	require.NoError(t, err)
+	assert.Equal(t, ":8002", cfg.HTTPAddress)
+
+	path = filepath.Join(dir, "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+jwt_token_ttl = "2h"
+webhook_max_attempts = 3
+auth_token_endpoint_enabled = true
+`), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err = GetConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, cfg.JWTTokenTTL)
+	assert.Equal(t, 3, cfg.WebhookMaxAttempts)
+	assert.True(t, cfg.AuthTokenEndpoint)
+	assert.Equal(t, []string{"user"}, cfg.AuthTokenRoles)
+
+	path = filepath.Join(dir, "unknown.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`redis_urls: redis://localhost:6380/1`), 0o600))
+	_, err = GetConfig([]string{"-config", path})
+	assert.ErrorContains(t, err, `unknown key "redis_urls"`)
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := GetConfig(nil)
+	require.NoError(t, err)
+
+	invalid := cfg
+	invalid.ShutdownTimeout = 0
+	invalid.LogLevel = "verbose"
+	invalid.EventsPublisher = "kafka"
+	invalid.RedisBreakerThreshold = 0
+	invalid.RedisBreakerCooldown = -time.Second
+	invalid.RedisStaleExpiration = 0
+	invalid.ShutdownDelay = -time.Second
+	invalid.AuthTokenEndpoint = true
+	invalid.AuthTokenRoles = nil
+	err = invalid.validate()
+	assert.ErrorContains(t, err, "shutdown timeout should be positive")
+	assert.ErrorContains(t, err, "Redis breaker threshold should be positive")
+	assert.ErrorContains(t, err, "Redis breaker cooldown should be positive")
+	assert.ErrorContains(t, err, "Redis stale expiration should be positive")
+	assert.ErrorContains(t, err, "shutdown delay should be from 0 to shutdown timeout")
+	assert.ErrorContains(t, err, `unknown log level "verbose"`)
+	assert.ErrorContains(t, err, "Kafka brokers should be set")
+	assert.ErrorContains(t, err, "roles of issued tokens should be set")
+
+	// в production значения по умолчанию запрещены
+	production := cfg
+	production.Environment = EnvironmentProduction
+	assert.ErrorContains(t, production.validate(), "default JWT private key is not allowed in production")
+	production.JWTPrivateKey = "production-key"
+	production.PostgreSqlDSN = "postgresql://banner:password@db:5432/banner"
+	production.RedisURl = "redis://redis:6379/0"
+	assert.NoError(t, production.validate())
+
+	production.JWTPrivateKey = JWTPrivateKeyDefault
+	production.JWTSigningKeysFile = "keys.json"
+	assert.NoError(t, production.validate())
+}
+
+func TestPrint(t *testing.T) {
+	cfg, err := GetConfig(nil)
+	require.NoError(t, err)
+	cfg.PostgreSqlDSN = "postgresql://banner:db-password@db:5432/banner?sslmode=disable"
+	cfg.JWTPrivateKey = "jwt-secret"
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), "db-password")
+	assert.NotContains(t, out.String(), "jwt-secret")
+	assert.Contains(t, out.String(), "postgres_dsn: postgresql://banner:REDACTED@db:5432/banner?sslmode=disable\n")
+	assert.Contains(t, out.String(), "rate_limit_user: 100:200\n")
+	assert.Contains(t, out.String(), "redis_expiration_duration: 5m0s\n")
+
+	// напечатанная конфигурация читается как файл
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, out.Bytes(), 0o600))
+	printed, err := GetConfig([]string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.RateLimitUser, printed.RateLimitUser)
+	assert.Equal(t, cfg.RedisExpirationDuration, printed.RedisExpirationDuration)
+	assert.Equal(t, redacted, printed.JWTPrivateKey)
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"postgresql://banner:secret@db:5432/banner", "postgresql://banner:REDACTED@db:5432/banner"},
+		{"redis://redis:6379/0?password=secret", "redis://redis:6379/0?password=REDACTED"},
+		{"host=db user=banner password=secret dbname=banner", "host=db user=banner password=REDACTED dbname=banner"},
+		{"host=db password = 'se cret \\' x' sslmode=disable", "host=db password = REDACTED sslmode=disable"},
+		{"host=db PASSWORD=secret", "host=db PASSWORD=REDACTED"},
+		{"localhost:6379", "localhost:6379"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, redactURL(test.value))
+	}
+}
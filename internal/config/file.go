@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caarlos0/env/v8"
+	"gopkg.in/yaml.v3"
+)
+
+// parseFile overrides config setup with values from YAML or TOML file, keys are environment variables in lower case.
+func (cfg *Config) parseFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		_, err = toml.Decode(string(data), &values)
+	default:
+		return fmt.Errorf("unknown format of config file %q, should be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't parse config file %q: %w", path, err)
+	}
+
+	environment, err := fileEnvironment(values)
+	if err != nil {
+		return fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+	return env.ParseWithOptions(cfg, env.Options{Environment: environment})
+}
+
+func fileEnvironment(values map[string]any) (map[string]string, error) {
+	known := envNames()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	environment := make(map[string]string, len(values))
+	for _, key := range keys {
+		name := strings.ToUpper(key)
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+		value, err := formatFileValue(values[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %q: %w", key, err)
+		}
+		environment[name] = value
+	}
+	return environment, nil
+}
+
+func formatFileValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			text, err := formatFileValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", fmt.Errorf("nested values aren't supported")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func envNames() map[string]struct{} {
+	names := map[string]struct{}{}
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if name := envName(configType.Field(i)); name != "" {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+func envName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+	return name
+}
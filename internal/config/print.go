@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+// Redacted returns copy of config with secrets replaced, passwords are removed from URLs.
+func (cfg Config) Redacted() Config {
+	if cfg.JWTPrivateKey != "" {
+		cfg.JWTPrivateKey = redacted
+	}
+	cfg.PostgreSqlDSN = redactURL(cfg.PostgreSqlDSN)
+	cfg.RedisURl = redactURL(cfg.RedisURl)
+	cfg.JWTJWKSURL = redactURL(cfg.JWTJWKSURL)
+	return cfg
+}
+
+// keywordPassword matches password in keyword/value connection string.
+var keywordPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactURL hides password and query of URL, which may contain tokens.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" {
+		// не URL, например DSN в формате key=value, host:port или путь к файлу
+		return keywordPassword.ReplaceAllString(value, "${1}"+redacted)
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			if strings.Contains(strings.ToLower(key), "password") || strings.Contains(strings.ToLower(key), "token") {
+				query.Set(key, redacted)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// Print writes effective config with secrets redacted in format of YAML config file.
+func (cfg Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	value := reflect.ValueOf(cfg.Redacted())
+	for i := 0; i < value.NumField(); i++ {
+		name := envName(value.Type().Field(i))
+		if name == "" {
+			continue
+		}
+		node := &yaml.Node{}
+		if err := node.Encode(printableValue(value.Field(i).Interface())); err != nil {
+			return fmt.Errorf("couldn't print %s: %w", name, err)
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: strings.ToLower(name)}, node)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func printableValue(value any) any {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case []string:
+		if v == nil {
+			return []string{}
+		}
+		return v
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(text)
+	default:
+		return v
+	}
+}
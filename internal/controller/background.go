@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// backgroundTasks runs work that outlives requests, like cache warm-up and revalidation,
+// and lets the controller cancel and wait for it on shutdown.
+type backgroundTasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func newBackgroundTasks() *backgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundTasks{ctx: ctx, cancel: cancel}
+}
+
+// run starts fn in background, it returns false if tasks are stopped.
+// Values of ctx like trace are kept, but fn's context is canceled only on stop.
+func (b *backgroundTasks) run(ctx context.Context, fn func(ctx context.Context)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopCancel := context.AfterFunc(b.ctx, cancel)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer cancel()
+		defer stopCancel()
+		fn(ctx)
+	}()
+	return true
+}
+
+// stop cancels running tasks and waits for them until ctx is done.
+func (b *backgroundTasks) stop(ctx context.Context) error {
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	b.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("couldn't wait for background tasks: %w", ctx.Err())
+	}
+}
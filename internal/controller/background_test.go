@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackgroundTasksStop(t *testing.T) {
+	tasks := newBackgroundTasks()
+
+	// отмена контекста запроса не прерывает задачу
+	requestCtx, cancelRequest := context.WithCancel(context.Background())
+	canceled := make(chan struct{})
+	require.True(t, tasks.run(requestCtx, func(ctx context.Context) {
+		<-ctx.Done()
+		close(canceled)
+	}))
+	cancelRequest()
+	select {
+	case <-canceled:
+		t.Fatal("task is canceled with request")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	require.NoError(t, tasks.stop(context.Background()))
+	assert.True(t, isClosed(canceled))
+	assert.False(t, tasks.run(context.Background(), func(ctx context.Context) {}), "tasks aren't started after stop")
+}
+
+func TestBackgroundTasksStopTimeout(t *testing.T) {
+	tasks := newBackgroundTasks()
+	release := make(chan struct{})
+	defer close(release)
+	// задача не реагирует на отмену
+	tasks.run(context.Background(), func(ctx context.Context) { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, tasks.stop(ctx), context.DeadlineExceeded)
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
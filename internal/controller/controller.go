@@ -2,82 +2,459 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/unbeman/av-banner-task/internal/logging"
 	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
 	"github.com/unbeman/av-banner-task/internal/storage"
+	"github.com/unbeman/av-banner-task/internal/utils"
 )
 
 type Controller struct {
-	database storage.Database
-	cache    storage.Cache
+	database    storage.Database
+	cache       storage.Cache
+	changes     *changeNotifier
+	revoked     *revocationCache
+	revalidator *revalidator
+	warmingUp   atomic.Bool
+	// tasks are warm-ups and revalidations running in background
+	tasks *backgroundTasks
 }
 
 func NewController(db storage.Database, cache storage.Cache) (*Controller, error) {
-	ctrl := &Controller{database: db, cache: cache}
+	tasks := newBackgroundTasks()
+	ctrl := &Controller{
+		database: db,
+		cache:    cache,
+		changes:  newChangeNotifier(),
+		revoked:  newRevocationCache(revocationCacheTTL, revocationCacheSize),
+
+		revalidator: newRevalidator(db, cache, tasks),
+		tasks:       tasks,
+	}
 	return ctrl, nil
 }
 
-func (c *Controller) GetBanner(ctx context.Context, input *models.GetBannerInput, isActive *bool) (*models.GetBannerOutput, error) {
+// Stop cancels cache warm-up and revalidations and waits for them until ctx is done.
+func (c *Controller) Stop(ctx context.Context) error {
+	err := c.tasks.stop(ctx)
+	log.Info("controller background tasks stopped")
+	return err
+}
+
+// GetBanner returns banner content, from cache unless the last revision is requested.
+// Cache errors are treated as misses, so database serves requests while cache is unavailable.
+// If database is unavailable, last known good copy from cache is returned with stale flag
+// and the banner is revalidated in background.
+func (c *Controller) GetBanner(ctx context.Context, input *models.GetBannerInput, isActive *bool) (_ *models.GetBannerOutput, stale bool, err error) {
+	ctx, span := tracer.Start(ctx, "Controller.GetBanner", trace.WithAttributes(
+		attribute.Int("banner.feature_id", input.FeatureId),
+		attribute.Int("banner.tag_id", input.TagId),
+		attribute.Bool("banner.use_last_revision", input.UseLastRevision),
+	))
+	defer func() { endSpan(span, err) }()
+	logging.AddFields(ctx, log.Fields{logging.FieldFeatureID: input.FeatureId, logging.FieldTagID: input.TagId})
+
 	var bannerContent *models.GetBannerOutput
 
 	if input.UseLastRevision {
 		banner, err := c.database.GetBanner(ctx, input.FeatureId, input.TagId, isActive)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		bannerContent = (*models.GetBannerOutput)(&banner.Content)
 
-		return bannerContent, nil
+		return bannerContent, false, nil
 	} else {
 		content, err := c.cache.GetBanner(ctx, input.FeatureId, input.TagId)
-
-		if errors.Is(err, storage.ErrNotFound) {
+		if err != nil {
+			// при недоступном кэше баннер берется из базы
+			if !errors.Is(err, storage.ErrNotFound) {
+				logCacheError(ctx, err)
+				cacheErrors.Inc()
+			}
+			cacheMisses.Inc()
+			span.SetAttributes(attribute.Bool("cache.hit", false))
 			banner, err := c.database.GetBanner(ctx, input.FeatureId, input.TagId, isActive)
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, false, err
+			}
 			if err != nil {
-				return nil, err
+				return c.getStaleBanner(ctx, input, isActive, err)
 			}
 			bannerContent = (*models.GetBannerOutput)(&banner.Content)
 
 			if banner.IsActive { // добавляем в кэш только активные баннеры
 				if err = c.cache.SetBanner(ctx, input.FeatureId, input.TagId, &banner.Content); err != nil {
-					return nil, err
+					logCacheError(ctx, err)
 				}
 			}
 
-			return bannerContent, nil
+			return bannerContent, false, nil
 		}
+		cacheHits.Inc()
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		bannerContent = (*models.GetBannerOutput)(content)
+
+		return bannerContent, false, nil
+	}
+}
+
+// getStaleBanner returns last known good copy of the banner and starts its revalidation, dbErr if there is no copy.
+func (c *Controller) getStaleBanner(ctx context.Context, input *models.GetBannerInput, isActive *bool, dbErr error) (*models.GetBannerOutput, bool, error) {
+	content, err := c.cache.GetStaleBanner(ctx, input.FeatureId, input.TagId)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			logCacheError(ctx, err)
+		}
+		return nil, false, dbErr
+	}
+	staleServed.Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("banner.stale", true))
+	c.revalidator.revalidate(ctx, input.FeatureId, input.TagId, isActive)
+	return (*models.GetBannerOutput)(content), true, nil
+}
+
+// GetUserBanners returns banners content for the set of features with given tag.
+// Cached banners are taken with one cache call, misses are loaded from database with one query.
+// Cache errors are treated as misses, stale copies are served as in GetBanner.
+func (c *Controller) GetUserBanners(ctx context.Context, input *models.GetUserBannersInput, isActive *bool) (_ *models.GetUserBannersOutput, stale bool, err error) {
+	ctx, span := tracer.Start(ctx, "Controller.GetUserBanners", trace.WithAttributes(
+		attribute.IntSlice("banner.feature_ids", input.FeatureIds),
+		attribute.Int("banner.tag_id", input.TagId),
+	))
+	defer func() { endSpan(span, err) }()
+	logging.AddFields(ctx, log.Fields{logging.FieldTagID: input.TagId})
+
+	out := make(models.GetUserBannersOutput, len(input.FeatureIds))
+
+	missedFeatureIds := input.FeatureIds
+	if !input.UseLastRevision {
+		cached, err := c.cache.GetBannersByFeatures(ctx, input.FeatureIds, input.TagId)
 		if err != nil {
-			return nil, err
+			logCacheError(ctx, err)
+			cacheErrors.Inc()
+			cached = nil
 		}
-		bannerContent = (*models.GetBannerOutput)(content)
+		missedFeatureIds = make([]int, 0, len(input.FeatureIds)-len(cached))
+		for _, featureId := range input.FeatureIds {
+			content, ok := cached[featureId]
+			if !ok {
+				missedFeatureIds = append(missedFeatureIds, featureId)
+				continue
+			}
+			out[featureId] = json.RawMessage(content)
+		}
+		cacheHits.Add(float64(len(cached)))
+		cacheMisses.Add(float64(len(missedFeatureIds)))
+	}
+
+	if len(missedFeatureIds) == 0 {
+		return &out, false, nil
+	}
+
+	banners, err := c.database.GetBannersByFeatures(ctx, missedFeatureIds, input.TagId, isActive)
+	if err != nil && input.UseLastRevision {
+		return nil, false, err
+	}
+	if err != nil {
+		return c.getStaleBanners(ctx, input.TagId, missedFeatureIds, isActive, out, err)
+	}
 
-		return bannerContent, nil
+	toCache := make(map[int]string, len(banners))
+	for featureId, banner := range banners {
+		out[featureId] = json.RawMessage(banner.Content)
+		if !input.UseLastRevision && banner.IsActive { // добавляем в кэш только активные баннеры
+			toCache[featureId] = banner.Content
+		}
+	}
+
+	if err = c.cache.SetBannersByFeatures(ctx, input.TagId, toCache); err != nil {
+		logCacheError(ctx, err)
 	}
+
+	return &out, false, nil
 }
 
-func (c *Controller) GetBanners(ctx context.Context, input *models.GetBannersInput) (*models.Banners, error) {
-	return c.database.GetBanners(ctx, input.FeatureId, input.TagId, input.Limit, input.Offset)
+// getStaleBanners adds last known good copies of missed banners to out, dbErr is returned if there are no copies.
+func (c *Controller) getStaleBanners(ctx context.Context, tagId int, missedFeatureIds []int, isActive *bool, out models.GetUserBannersOutput, dbErr error) (*models.GetUserBannersOutput, bool, error) {
+	found := 0
+	for _, featureId := range missedFeatureIds {
+		content, err := c.cache.GetStaleBanner(ctx, featureId, tagId)
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				logCacheError(ctx, err)
+			}
+			continue
+		}
+		out[featureId] = json.RawMessage(*content)
+		found++
+		c.revalidator.revalidate(ctx, featureId, tagId, isActive)
+	}
+	if found == 0 {
+		return nil, false, dbErr
+	}
+	staleServed.Add(float64(found))
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("banner.stale", true))
+	return &out, true, nil
 }
 
-func (c *Controller) CreateBanner(ctx context.Context, input *models.CreateBannerInput) (*models.CreateBannerOutput, error) {
+// GetBanners returns banners of features available to the caller.
+func (c *Controller) GetBanners(ctx context.Context, input *models.GetBannersInput) (_ *models.Banners, err error) {
+	ctx, span := tracer.Start(ctx, "Controller.GetBanners")
+	defer func() { endSpan(span, err) }()
+
+	featureIds := rbac.ScopeFromContext(ctx).FeatureIds()
+	return c.database.GetBanners(ctx, input.FeatureId, input.TagId, featureIds, input.Limit, input.Offset)
+}
+
+func (c *Controller) CreateBanner(ctx context.Context, input *models.CreateBannerInput) (_ *models.CreateBannerOutput, err error) {
+	ctx, span := tracer.Start(ctx, "Controller.CreateBanner", trace.WithAttributes(attribute.Int("banner.feature_id", input.FeatureId)))
+	defer func() { endSpan(span, err) }()
+	logging.AddFields(ctx, log.Fields{logging.FieldFeatureID: input.FeatureId})
+
+	if err := rbac.CheckFeature(ctx, input.FeatureId); err != nil {
+		return nil, err
+	}
+
 	banner := &models.Banner{
 		FeatureId: input.FeatureId,
 		TagIds:    input.TagIds,
 		Content:   input.Content,
 		IsActive:  input.IsActive,
 	}
-	banner, err := c.database.CreateBanner(ctx, banner)
+	banner, err = c.database.CreateBanner(ctx, banner)
 	if err != nil {
 		return nil, err
 	}
+	logging.AddFields(ctx, log.Fields{logging.FieldBannerID: banner.Id})
+	c.changes.notify()
 	bannerOut := &models.CreateBannerOutput{BannerId: banner.Id}
 	return bannerOut, nil
 }
 
-func (c *Controller) UpdateBanner(ctx context.Context, input *models.UpdateBannerInput) error {
-	return c.database.UpdateBanner(ctx, input)
+// UpdateBanner updates banner if the caller has access to both its current and new feature.
+func (c *Controller) UpdateBanner(ctx context.Context, input *models.UpdateBannerInput) (err error) {
+	ctx, span := tracer.Start(ctx, "Controller.UpdateBanner", trace.WithAttributes(attribute.Int("banner.id", input.Id)))
+	defer func() { endSpan(span, err) }()
+	logging.AddFields(ctx, log.Fields{logging.FieldBannerID: input.Id})
+
+	current, err := c.database.GetBannerById(ctx, input.Id)
+	if err != nil {
+		return err
+	}
+	if err = rbac.CheckFeature(ctx, current.FeatureId); err != nil {
+		return err
+	}
+	if input.FeatureId != nil {
+		if err = rbac.CheckFeature(ctx, *input.FeatureId); err != nil {
+			return err
+		}
+	}
+
+	if err = c.database.UpdateBanner(ctx, input); err != nil {
+		return err
+	}
+	// пары фичи и тегов уникальны, поэтому в кэше могут быть только прежние
+	c.invalidateBanner(ctx, current)
+	c.changes.notify()
+	return nil
+}
+
+func (c *Controller) DeleteBanner(ctx context.Context, bannerId int) (err error) {
+	ctx, span := tracer.Start(ctx, "Controller.DeleteBanner", trace.WithAttributes(attribute.Int("banner.id", bannerId)))
+	defer func() { endSpan(span, err) }()
+	logging.AddFields(ctx, log.Fields{logging.FieldBannerID: bannerId})
+
+	banner, err := c.database.GetBannerById(ctx, bannerId)
+	if err != nil {
+		return err
+	}
+	if err = rbac.CheckFeature(ctx, banner.FeatureId); err != nil {
+		return err
+	}
+
+	if err = c.database.DeleteBanner(ctx, bannerId); err != nil {
+		return err
+	}
+	c.invalidateBanner(ctx, banner)
+	c.changes.notify()
+	return nil
+}
+
+// invalidateBanner removes cached and last known good copies of changed banner.
+func (c *Controller) invalidateBanner(ctx context.Context, banner *models.Banner) {
+	if err := c.cache.DeleteBanners(ctx, banner.FeatureId, banner.TagIds); err != nil {
+		logCacheError(ctx, err)
+	}
+}
+
+// GetBannerChanges returns up to limit changes after the cursor within the caller's features.
+func (c *Controller) GetBannerChanges(ctx context.Context, after models.BannerChangeCursor, limit int) ([]*models.BannerChange, error) {
+	featureIds := rbac.ScopeFromContext(ctx).FeatureIds()
+	return c.database.GetBannerChanges(ctx, after, featureIds, limit)
+}
+
+func (c *Controller) GetLastBannerChangeCursor(ctx context.Context) (models.BannerChangeCursor, error) {
+	return c.database.GetLastBannerChangeCursor(ctx)
+}
+
+// SubscribeBannerChanges returns channel signaling about new banner changes and function to unsubscribe.
+func (c *Controller) SubscribeBannerChanges() (<-chan struct{}, func()) {
+	return c.changes.subscribe()
+}
+
+func (c *Controller) CreateWebhook(ctx context.Context, input *models.CreateWebhookInput) (*models.CreateWebhookOutput, error) {
+	webhook := &models.Webhook{
+		URL:    input.URL,
+		Secret: input.Secret,
+		Events: input.Events,
+	}
+	webhook, err := c.database.CreateWebhook(ctx, webhook)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CreateWebhookOutput{WebhookId: webhook.Id}, nil
+}
+
+func (c *Controller) GetWebhooks(ctx context.Context) (models.Webhooks, error) {
+	return c.database.GetWebhooks(ctx)
+}
+
+func (c *Controller) DeleteWebhook(ctx context.Context, webhookId int) error {
+	return c.database.DeleteWebhook(ctx, webhookId)
+}
+
+func (c *Controller) GetWebhookDeliveries(ctx context.Context, input *models.GetWebhookDeliveriesInput) (models.WebhookDeliveries, error) {
+	return c.database.GetWebhookDeliveries(ctx, input.WebhookId, input.Status, input.Limit, input.Offset)
+}
+
+// GetAuditRecords returns audit records of banner changes, starting from the latest.
+func (c *Controller) GetAuditRecords(ctx context.Context, input *models.GetAuditInput) (models.AuditRecords, error) {
+	return c.database.GetAuditRecords(ctx, input)
+}
+
+// CreateAPIKey generates new API key, the key itself is returned only once.
+func (c *Controller) CreateAPIKey(ctx context.Context, input *models.CreateAPIKeyInput) (*models.CreateAPIKeyOutput, error) {
+	// ключ не может управлять фичами вне области создателя
+	if scope := rbac.ScopeFromContext(ctx); scope != nil {
+		if input.FeatureIds == nil {
+			return nil, fmt.Errorf("unlimited API key: %w", rbac.ErrFeatureOutOfScope)
+		}
+		for _, featureId := range input.FeatureIds {
+			if !scope.Contains(featureId) {
+				return nil, fmt.Errorf("feature (%d): %w", featureId, rbac.ErrFeatureOutOfScope)
+			}
+		}
+	}
+
+	key, prefix, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	apiKey := &models.APIKey{
+		Prefix:      prefix,
+		Hash:        utils.HashAPIKey(key),
+		Role:        input.Role,
+		Scopes:      input.Scopes,
+		FeatureIds:  input.FeatureIds,
+		Description: input.Description,
+	}
+	apiKey, err = c.database.CreateAPIKey(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CreateAPIKeyOutput{ApiKeyId: apiKey.Id, Key: key}, nil
+}
+
+// GetAPIKeys returns API keys, caller limited to features sees only keys within its features.
+func (c *Controller) GetAPIKeys(ctx context.Context) (models.APIKeys, error) {
+	return c.database.GetAPIKeys(ctx, rbac.ScopeFromContext(ctx).FeatureIds())
+}
+
+// RevokeAPIKey revokes API key, caller limited to features can revoke only keys within its features.
+func (c *Controller) RevokeAPIKey(ctx context.Context, keyId int) error {
+	return c.database.RevokeAPIKey(ctx, keyId, rbac.ScopeFromContext(ctx).FeatureIds())
+}
+
+// AuthenticateAPIKey returns active API key, storage.ErrNotFound if the key is unknown or revoked.
+func (c *Controller) AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+	return c.database.GetActiveAPIKey(ctx, utils.HashAPIKey(key))
 }
 
-func (c *Controller) DeleteBanner(ctx context.Context, bannerId int) error {
-	return c.database.DeleteBanner(ctx, bannerId)
+// RevokeToken stores revoked token in database and marks it in cache, expiresAt is the token expiration time if known.
+func (c *Controller) RevokeToken(ctx context.Context, jti string, expiresAt *time.Time, reason string) error {
+	err := c.database.RevokeToken(ctx, &models.RevokedToken{Jti: jti, ExpiresAt: expiresAt, Reason: reason})
+	if err != nil {
+		return err
+	}
+	c.revoked.set(jti, true, expiresAt)
+	// отзыв уже сохранен в базе, в Redis его скопирует SyncRevokedTokens при запуске
+	if err = c.cache.SetRevokedToken(ctx, jti, revokedTokenExpiration(expiresAt)); err != nil {
+		logging.FromContext(ctx).Errorf("couldn't save revoked token to cache: %v", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked checks token in local cache, then in Redis, database is used if Redis is unavailable.
+// expiresAt is the token expiration time if known, it limits how long revoked token is cached.
+func (c *Controller) IsTokenRevoked(ctx context.Context, jti string, expiresAt *time.Time) (bool, error) {
+	if jti == "" { // токены без jti выпущены до появления отзыва
+		return false, nil
+	}
+	if revoked, ok := c.revoked.get(jti); ok {
+		return revoked, nil
+	}
+
+	revoked, err := c.cache.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("couldn't check revoked token in cache: %v", err)
+		revoked, err = c.database.IsTokenRevoked(ctx, jti)
+		if err != nil {
+			return false, err
+		}
+	}
+	c.revoked.set(jti, revoked, expiresAt)
+	return revoked, nil
+}
+
+// SyncRevokedTokens copies not expired revoked tokens from database to cache, e.g. after cache data loss.
+func (c *Controller) SyncRevokedTokens(ctx context.Context) error {
+	tokens, err := c.database.GetRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err = c.cache.SetRevokedToken(ctx, token.Jti, revokedTokenExpiration(token.ExpiresAt)); err != nil {
+			return err
+		}
+	}
+	logging.FromContext(ctx).Infof("synced %d revoked tokens to cache", len(tokens))
+	return nil
+}
+
+// revokedTokenExpiration returns how long revoked token should be kept in cache, zero means forever.
+func revokedTokenExpiration(expiresAt *time.Time) time.Duration {
+	if expiresAt == nil {
+		return 0
+	}
+	// истекший токен и так не пройдет проверку, но храним его немного на случай расхождения часов
+	return max(time.Until(*expiresAt), time.Minute)
+}
+
+// logCacheError logs cache error unless cache is known to be unavailable, it's logged once by circuit breaker then.
+func logCacheError(ctx context.Context, err error) {
+	if errors.Is(err, storage.ErrUnavailable) {
+		return
+	}
+	logging.FromContext(ctx).Warnf("cache error, falling back to database: %v", err)
 }
@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "banner_cache_requests_total",
+	Help: "Count of banner lookups in cache by result: hit, miss or error. Errors are counted as misses too.",
+}, []string{"result"})
+
+var (
+	cacheHits   = cacheRequests.WithLabelValues("hit")
+	cacheMisses = cacheRequests.WithLabelValues("miss")
+	cacheErrors = cacheRequests.WithLabelValues("error")
+)
+
+var staleServed = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "banner_stale_served_total",
+	Help: "Count of last known good banner copies served because database was unavailable.",
+})
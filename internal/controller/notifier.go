@@ -0,0 +1,39 @@
+package controller
+
+import "sync"
+
+// changeNotifier wakes up subscribers when new banner changes are recorded.
+type changeNotifier struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{subscribers: make(map[chan struct{}]struct{})}
+}
+
+func (n *changeNotifier) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	n.subscribers[ch] = struct{}{}
+	n.mu.Unlock()
+
+	unsubscribe := func() {
+		n.mu.Lock()
+		delete(n.subscribers, ch)
+		n.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+func (n *changeNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// revocationCacheTTL limits how long a replica accepts token revoked on another replica.
+	revocationCacheTTL = 5 * time.Second
+	// revokedCacheMaxTTL limits how long revoked token without known expiration is cached.
+	revokedCacheMaxTTL = time.Hour
+	// revocationCacheSize limits count of tokens in local cache.
+	revocationCacheSize = 10000
+)
+
+type revocationEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// revocationCache is a small local cache of token revocation checks to avoid Redis call on every request.
+// Revoked tokens are kept until token expiration, since revocation is never cancelled.
+type revocationCache struct {
+	mu      sync.Mutex
+	entries map[string]revocationEntry
+	ttl     time.Duration
+	size    int
+	now     func() time.Time
+}
+
+func newRevocationCache(ttl time.Duration, size int) *revocationCache {
+	return &revocationCache{
+		entries: make(map[string]revocationEntry),
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+	}
+}
+
+// get returns cached revocation state of the token, ok is false if there is no actual state.
+func (c *revocationCache) get(jti string) (revoked bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[jti]
+	if !ok {
+		return false, false
+	}
+	if c.now().After(entry.expiresAt) {
+		delete(c.entries, jti)
+		return false, false
+	}
+	return entry.revoked, true
+}
+
+// set stores revocation state of the token, expiresAt is the token expiration time if known.
+func (c *revocationCache) set(jti string, revoked bool, expiresAt *time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.entries) >= c.size {
+		for key, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		// все записи актуальны, проще начать заново, чем вести очередь вытеснения
+		if len(c.entries) >= c.size {
+			clear(c.entries)
+		}
+	}
+	entry := revocationEntry{revoked: revoked, expiresAt: now.Add(c.ttl)}
+	if revoked {
+		entry.expiresAt = now.Add(revokedCacheMaxTTL)
+		if expiresAt != nil && expiresAt.Before(entry.expiresAt) {
+			entry.expiresAt = *expiresAt
+		}
+	}
+	c.entries[jti] = entry
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocationCacheExpiration(t *testing.T) {
+	now := time.Now()
+	cache := newRevocationCache(revocationCacheTTL, revocationCacheSize)
+	cache.now = func() time.Time { return now }
+
+	tokenExpiration := now.Add(time.Minute)
+	cache.set("active", false, &tokenExpiration)
+	cache.set("revoked", true, &tokenExpiration)
+	cache.set("revoked-without-exp", true, nil)
+
+	now = now.Add(revocationCacheTTL + time.Second)
+	_, ok := cache.get("active")
+	assert.False(t, ok, "active token is rechecked after ttl")
+	revoked, ok := cache.get("revoked")
+	assert.True(t, ok)
+	assert.True(t, revoked)
+
+	now = tokenExpiration.Add(time.Second)
+	_, ok = cache.get("revoked")
+	assert.False(t, ok, "revoked token is dropped after its expiration")
+	_, ok = cache.get("revoked-without-exp")
+	assert.True(t, ok)
+
+	now = now.Add(revokedCacheMaxTTL)
+	_, ok = cache.get("revoked-without-exp")
+	assert.False(t, ok, "revoked token without expiration is dropped after max ttl")
+	assert.Empty(t, cache.entries)
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/unbeman/av-banner-task/internal/logging"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+const (
+	revalidationTimeout = 5 * time.Second
+	// revalidationInterval limits attempts to revalidate the same banner while database is unavailable.
+	revalidationInterval = time.Second
+)
+
+// revalidator refreshes cached banners in background after stale copies were served.
+type revalidator struct {
+	database storage.Database
+	cache    storage.Cache
+	tasks    *backgroundTasks
+
+	mu       sync.Mutex
+	attempts map[string]time.Time
+	inFlight map[string]struct{}
+	now      func() time.Time
+}
+
+func newRevalidator(db storage.Database, cache storage.Cache, tasks *backgroundTasks) *revalidator {
+	return &revalidator{
+		database: db,
+		cache:    cache,
+		tasks:    tasks,
+		attempts: make(map[string]time.Time),
+		inFlight: make(map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+// revalidate starts background load of the banner from database and caches it if database is available again.
+func (r *revalidator) revalidate(ctx context.Context, featureId, tagId int, isActive *bool) {
+	key := fmt.Sprintf("%d-%d", featureId, tagId)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.inFlight[key]; ok {
+		return
+	}
+	if last, ok := r.attempts[key]; ok && r.now().Sub(last) < revalidationInterval {
+		return
+	}
+	// трассировка запроса сохраняется, но его отмена не прерывает обновление
+	started := r.tasks.run(ctx, func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, revalidationTimeout)
+		defer cancel()
+		revalidated := r.load(ctx, featureId, tagId, isActive)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.inFlight, key)
+		if revalidated {
+			delete(r.attempts, key)
+		}
+		r.pruneAttempts()
+	})
+	if started {
+		r.inFlight[key] = struct{}{}
+		r.attempts[key] = r.now()
+	}
+}
+
+// pruneAttempts is called with r.mu held.
+func (r *revalidator) pruneAttempts() {
+	now := r.now()
+	for key, last := range r.attempts {
+		if _, ok := r.inFlight[key]; !ok && now.Sub(last) >= revalidationInterval {
+			delete(r.attempts, key)
+		}
+	}
+}
+
+// load returns true if database responded.
+func (r *revalidator) load(ctx context.Context, featureId, tagId int, isActive *bool) bool {
+	banner, err := r.database.GetBanner(ctx, featureId, tagId, isActive)
+	if err != nil {
+		logging.FromContext(ctx).Debugf("couldn't revalidate banner (feature %d, tag %d): %v", featureId, tagId, err)
+		return false
+	}
+	if banner.IsActive { // добавляем в кэш только активные баннеры
+		if err = r.cache.SetBanner(ctx, featureId, tagId, &banner.Content); err != nil {
+			logCacheError(ctx, err)
+		}
+	}
+	logging.FromContext(ctx).Infof("banner (feature %d, tag %d) is revalidated after serving stale copy", featureId, tagId)
+	return true
+}
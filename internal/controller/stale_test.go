@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+// bannerDatabase returns banner after release, other methods of storage.Database aren't used.
+type bannerDatabase struct {
+	storage.Database
+	release chan error
+	calls   chan struct{}
+}
+
+func (d *bannerDatabase) GetBanner(ctx context.Context, featureId int, tagId int, isActive *bool) (*models.Banner, error) {
+	d.calls <- struct{}{}
+	if err := <-d.release; err != nil {
+		return nil, err
+	}
+	return &models.Banner{FeatureId: featureId, TagIds: []int{tagId}, Content: `{"title":"fresh"}`, IsActive: true}, nil
+}
+
+// bannerCache records cached banners, other methods of storage.Cache aren't used.
+type bannerCache struct {
+	storage.Cache
+	mu      sync.Mutex
+	banners map[int]string
+}
+
+func (c *bannerCache) SetBanner(ctx context.Context, featureId, tagId int, bannerContent *string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.banners[featureId] = *bannerContent
+	return nil
+}
+
+func (c *bannerCache) get(featureId int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.banners[featureId]
+}
+
+func TestRevalidator(t *testing.T) {
+	database := &bannerDatabase{release: make(chan error), calls: make(chan struct{}, 10)}
+	cache := &bannerCache{banners: map[int]string{}}
+	r := newRevalidator(database, cache, newBackgroundTasks())
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// пока идет попытка, новые не запускаются
+	r.revalidate(ctx, 1, 1, nil)
+	<-database.calls
+	r.revalidate(ctx, 1, 1, nil)
+	database.release <- errors.New("connection refused")
+
+	// после неудачи следующая попытка возможна только через интервал
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.inFlight) == 0
+	}, time.Second, time.Millisecond)
+	r.revalidate(ctx, 1, 1, nil)
+	assert.Empty(t, database.calls)
+
+	attempts := func() int {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.attempts)
+	}
+
+	// завершенная попытка другого баннера удаляет устаревшие попытки
+	now = now.Add(revalidationInterval)
+	r.revalidate(ctx, 2, 1, nil)
+	<-database.calls
+	database.release <- nil
+	assert.Eventually(t, func() bool { return cache.get(2) == `{"title":"fresh"}` && attempts() == 0 }, time.Second, time.Millisecond)
+
+	r.revalidate(ctx, 1, 1, nil)
+	<-database.calls
+	database.release <- nil
+	assert.Eventually(t, func() bool { return cache.get(1) == `{"title":"fresh"}` && attempts() == 0 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+var tracer = otel.Tracer("github.com/unbeman/av-banner-task/internal/controller")
+
+// endSpan records unexpected error of the operation and ends its span.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
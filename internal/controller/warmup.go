@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/unbeman/av-banner-task/internal/logging"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+// warmUpBatchSize is a count of banners cached with one pipeline.
+const warmUpBatchSize = 500
+
+// ErrWarmUpInProgress is returned if cache warm-up is requested while the previous one is running.
+var ErrWarmUpInProgress = errors.New("cache warm-up is already in progress")
+
+// ErrStopped is returned if background work is requested after the controller was stopped.
+var ErrStopped = errors.New("controller is stopped")
+
+// WarmUpCache loads active banners from database to cache, recently updated first, limit bounds count of banners if positive.
+// Returns count of cached banners.
+func (c *Controller) WarmUpCache(ctx context.Context, limit int) (int, error) {
+	if !c.warmingUp.CompareAndSwap(false, true) {
+		return 0, ErrWarmUpInProgress
+	}
+	defer c.warmingUp.Store(false)
+	return c.warmUpCache(ctx, limit)
+}
+
+// StartWarmUpCache runs WarmUpCache in background, cancellation of ctx doesn't stop it, but Stop does.
+func (c *Controller) StartWarmUpCache(ctx context.Context, limit int) error {
+	if !c.warmingUp.CompareAndSwap(false, true) {
+		return ErrWarmUpInProgress
+	}
+	started := c.tasks.run(ctx, func(ctx context.Context) {
+		defer c.warmingUp.Store(false)
+		c.warmUpCache(ctx, limit)
+	})
+	if !started {
+		c.warmingUp.Store(false)
+		return ErrStopped
+	}
+	return nil
+}
+
+func (c *Controller) warmUpCache(ctx context.Context, limit int) (int, error) {
+	ctx, span := tracer.Start(ctx, "Controller.WarmUpCache")
+	var err error
+	defer func() { endSpan(span, err) }()
+	ctx = logging.NewContext(ctx, log.Fields{"task": "cache_warmup"})
+	logger := logging.FromContext(ctx)
+
+	start := time.Now()
+	logger.Info("cache warm-up started")
+	count := 0
+	batch := make([]storage.CachedBanner, 0, warmUpBatchSize)
+	flush := func() error {
+		if err := c.cache.SetBanners(ctx, batch); err != nil {
+			return fmt.Errorf("couldn't cache banners: %w", err)
+		}
+		count += len(batch)
+		batch = batch[:0]
+		logger.Infof("cache warm-up: %d banners cached", count)
+		return nil
+	}
+
+	err = c.database.StreamActiveBanners(ctx, limit, func(banner storage.CachedBanner) error {
+		batch = append(batch, banner)
+		if len(batch) < warmUpBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		logger.Errorf("cache warm-up failed after %d banners: %v", count, err)
+		return count, err
+	}
+	logger.Infof("cache warm-up finished: %d banners cached in %s", count, time.Since(start).Round(time.Millisecond))
+	return count, nil
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+const (
+	cleanupBatchSize = 1000
+	cleanupInterval  = time.Hour
+)
+
+// Cleaner removes processed outbox events older than retention, so outbox doesn't grow without bound.
+// Events are kept until webhook deliveries are finished and, if events publishing is enabled, until relay publishes them.
+type Cleaner struct {
+	outbox        storage.OutboxCleaner
+	retention     time.Duration
+	waitPublished bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewCleaner(outbox storage.OutboxCleaner, retention time.Duration, waitPublished bool) *Cleaner {
+	return &Cleaner{
+		outbox:        outbox,
+		retention:     retention,
+		waitPublished: waitPublished,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Run removes processed events until Stop is called.
+func (c *Cleaner) Run() {
+	log.Info("starting outbox cleaner")
+	defer close(c.done)
+
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		c.clean(context.Background())
+
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop waits current batch to finish and stops cleaner.
+func (c *Cleaner) Stop() {
+	close(c.stop)
+	<-c.done
+	log.Info("outbox cleaner stopped")
+}
+
+func (c *Cleaner) clean(ctx context.Context) {
+	total := 0
+	for {
+		deleted, err := c.outbox.DeleteProcessedEvents(ctx, c.retention, c.waitPublished, cleanupBatchSize)
+		if err != nil {
+			log.Errorf("couldn't delete processed outbox events: %v", err)
+			break
+		}
+		total += deleted
+		// пачками, чтобы не держать долгую блокировку таблицы
+		if deleted < cleanupBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Infof("deleted %d processed outbox events", total)
+	}
+}
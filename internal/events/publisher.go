@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+// Message is a Kafka-compatible message: events with the same key keep their order.
+type Message struct {
+	Key     string            `json:"key"`
+	Value   json.RawMessage   `json:"value"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// EventHeader is a message header with banner event name.
+const EventHeader = "event"
+
+// Publisher sends messages to a message bus.
+type Publisher interface {
+	Publish(ctx context.Context, message *Message) error
+	Close() error
+}
+
+// NewMessage builds message of banner event keyed by banner id.
+func NewMessage(event *models.BannerEvent) (*Message, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal banner event: %w", err)
+	}
+	return &Message{
+		Key:     strconv.Itoa(event.BannerId),
+		Value:   value,
+		Headers: map[string]string{EventHeader: event.Event},
+	}, nil
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+const (
+	batchSize = 100
+	// relayLease is how long other relays wait for the batch to be published
+	relayLease = time.Minute
+)
+
+// Relay publishes banner events from outbox with at-least-once guarantee.
+// Events of one banner are published in order: after failure the rest of banner events wait for the next run.
+type Relay struct {
+	outbox    storage.EventOutbox
+	publisher Publisher
+	interval  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewRelay(outbox storage.EventOutbox, publisher Publisher, interval time.Duration) *Relay {
+	return &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Run publishes outbox events until Stop is called.
+func (r *Relay) Run() {
+	log.Info("starting events relay")
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.relay(context.Background())
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop waits current batch to finish, stops relay and closes publisher.
+func (r *Relay) Stop() {
+	close(r.stop)
+	<-r.done
+	if err := r.publisher.Close(); err != nil {
+		log.Errorf("couldn't close events publisher: %v", err)
+	}
+	log.Info("events relay stopped")
+}
+
+func (r *Relay) relay(ctx context.Context) {
+	for {
+		holder, events, err := r.outbox.ClaimBannerEvents(ctx, batchSize, relayLease)
+		if err != nil {
+			log.Errorf("couldn't claim banner events: %v", err)
+			return
+		}
+		if holder == "" {
+			return
+		}
+		published, failed := r.publishBatch(ctx, events)
+		if err = r.outbox.FinishBannerEvents(ctx, holder, published); err != nil {
+			log.Errorf("couldn't mark banner events published: %v", err)
+			return
+		}
+		if len(events) < batchSize || failed {
+			return
+		}
+	}
+}
+
+// publishBatch publishes events until the lease expires and returns ids of published ones.
+// Events of a banner after its failed event are left for the next run.
+func (r *Relay) publishBatch(ctx context.Context, events []*models.BannerEvent) ([]int, bool) {
+	ctx, cancel := context.WithTimeout(ctx, relayLease)
+	defer cancel()
+
+	published := make([]int, 0, len(events))
+	failed := make(map[int]struct{})
+	for _, event := range events {
+		if _, ok := failed[event.BannerId]; ok {
+			continue
+		}
+		if err := r.publish(ctx, event); err != nil {
+			failed[event.BannerId] = struct{}{}
+			log.Errorf("couldn't publish banner event %d: %v", event.Id, err)
+			continue
+		}
+		published = append(published, event.Id)
+	}
+	return published, len(failed) > 0
+}
+
+func (r *Relay) publish(ctx context.Context, event *models.BannerEvent) error {
+	message, err := NewMessage(event)
+	if err != nil {
+		return err
+	}
+	return r.publisher.Publish(ctx, message)
+}
@@ -0,0 +1,187 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+// fakeOutbox keeps events in memory and follows storage.EventOutbox contract.
+type fakeOutbox struct {
+	events    []*models.BannerEvent
+	published map[int]bool
+	leased    bool // аренду держит другой relay
+}
+
+func (o *fakeOutbox) ClaimBannerEvents(ctx context.Context, limit int, lease time.Duration) (string, []*models.BannerEvent, error) {
+	if o.leased {
+		return "", nil, nil
+	}
+	var events []*models.BannerEvent
+	for _, event := range o.events {
+		if !o.published[event.Id] && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return "relay", events, nil
+}
+
+func (o *fakeOutbox) FinishBannerEvents(ctx context.Context, holder string, published []int) error {
+	for _, id := range published {
+		o.published[id] = true
+	}
+	return nil
+}
+
+// DeleteProcessedEvents follows storage.OutboxCleaner contract, all events are considered expired.
+func (o *fakeOutbox) DeleteProcessedEvents(ctx context.Context, retention time.Duration, published bool, limit int) (int, error) {
+	kept := o.events[:0]
+	deleted := 0
+	for _, event := range o.events {
+		if deleted < limit && (o.published[event.Id] || !published) {
+			deleted++
+			continue
+		}
+		kept = append(kept, event)
+	}
+	o.events = kept
+	return deleted, nil
+}
+
+// flakyPublisher fails to publish events with given ids once.
+type flakyPublisher struct {
+	*MemoryPublisher
+	failOnce map[int]bool
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, message *Message) error {
+	event := &models.BannerEvent{}
+	if err := json.Unmarshal(message.Value, event); err != nil {
+		return err
+	}
+	if p.failOnce[event.Id] {
+		delete(p.failOnce, event.Id)
+		return errors.New("broker is unavailable")
+	}
+	return p.MemoryPublisher.Publish(ctx, message)
+}
+
+func newEvent(id, bannerId int, event string) *models.BannerEvent {
+	return &models.BannerEvent{
+		Id:        id,
+		Event:     event,
+		BannerId:  bannerId,
+		Banner:    json.RawMessage(`{"banner_id":` + strconv.Itoa(bannerId) + `}`),
+		CreatedAt: time.Now(),
+	}
+}
+
+func publishedEventIds(t *testing.T, messages []Message) []int {
+	ids := make([]int, 0, len(messages))
+	for _, message := range messages {
+		event := &models.BannerEvent{}
+		require.NoError(t, json.Unmarshal(message.Value, event))
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
+
+func TestRelayKeepsOrderPerBanner(t *testing.T) {
+	outbox := &fakeOutbox{
+		events: []*models.BannerEvent{
+			newEvent(1, 1, models.BannerCreated),
+			newEvent(2, 2, models.BannerCreated),
+			newEvent(3, 1, models.BannerUpdated),
+			newEvent(4, 2, models.BannerDeactivated),
+			newEvent(5, 1, models.BannerDeleted),
+		},
+		published: make(map[int]bool),
+	}
+	publisher := &flakyPublisher{MemoryPublisher: NewMemoryPublisher(), failOnce: map[int]bool{3: true}}
+	relay := NewRelay(outbox, publisher, time.Second)
+
+	relay.relay(context.Background())
+
+	// события баннера 1 после неудачного 3 ждут следующего запуска, баннер 2 публикуется полностью
+	assert.Equal(t, []int{1, 2, 4}, publishedEventIds(t, publisher.Messages()))
+
+	relay.relay(context.Background())
+
+	assert.Equal(t, []int{1, 2, 4, 3, 5}, publishedEventIds(t, publisher.Messages()))
+
+	messages := publisher.Messages()
+	assert.Equal(t, "1", messages[3].Key)
+	assert.Equal(t, models.BannerUpdated, messages[3].Headers[EventHeader])
+}
+
+func TestRelayWaitsForLease(t *testing.T) {
+	outbox := &fakeOutbox{events: []*models.BannerEvent{newEvent(1, 1, models.BannerCreated)}, published: make(map[int]bool), leased: true}
+	publisher := NewMemoryPublisher()
+	relay := NewRelay(outbox, publisher, time.Second)
+
+	relay.relay(context.Background())
+	assert.Empty(t, publisher.Messages())
+
+	outbox.leased = false
+	relay.relay(context.Background())
+	assert.Equal(t, []int{1}, publishedEventIds(t, publisher.Messages()))
+	assert.True(t, outbox.published[1])
+}
+
+func TestCleanerKeepsNotPublishedEvents(t *testing.T) {
+	outbox := &fakeOutbox{published: map[int]bool{}}
+	for id := 1; id <= cleanupBatchSize+1; id++ {
+		outbox.events = append(outbox.events, newEvent(id, id, models.BannerCreated))
+		outbox.published[id] = true
+	}
+	outbox.events = append(outbox.events, newEvent(cleanupBatchSize+2, 1, models.BannerUpdated))
+
+	NewCleaner(outbox, time.Hour, true).clean(context.Background())
+
+	// удаление идет пачками, пока не останутся только неопубликованные события
+	require.Len(t, outbox.events, 1)
+	assert.Equal(t, cleanupBatchSize+2, outbox.events[0].Id)
+
+	NewCleaner(outbox, time.Hour, false).clean(context.Background())
+
+	assert.Empty(t, outbox.events)
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	publisher, err := NewFilePublisher(path)
+	require.NoError(t, err)
+
+	for _, event := range []*models.BannerEvent{newEvent(1, 1, models.BannerCreated), newEvent(2, 1, models.BannerDeleted)} {
+		message, err := NewMessage(event)
+		require.NoError(t, err)
+		require.NoError(t, publisher.Publish(context.Background(), message))
+	}
+	require.NoError(t, publisher.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var messages []Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		message := Message{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &message))
+		messages = append(messages, message)
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []int{1, 2}, publishedEventIds(t, messages))
+	assert.Equal(t, models.BannerDeleted, messages[1].Headers[EventHeader])
+}
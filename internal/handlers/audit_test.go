@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+)
+
+func TestAuditLog(t *testing.T) {
+	h := newTestHandler(t)
+	alice, bob := h.subjectToken("alice", rbac.RoleOwner), h.subjectToken("bob", rbac.RolePublisher)
+	do := func(token, requestId, method, url, body string) *httptest.ResponseRecorder {
+		request := h.newRequest(token, method, url, body)
+		if requestId != "" {
+			request.Header.Set(RequestIDHeader, requestId)
+		}
+		return h.serve(request)
+	}
+	records := func(url string) models.AuditRecords {
+		recorder := do(alice, "", http.MethodGet, url, "")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		records := models.AuditRecords{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &records))
+		return records
+	}
+
+	require.Equal(t, http.StatusCreated, do(alice, "req-1", http.MethodPost, "/banner", `{"feature_id": 1, "tag_ids": [2, 1], "content": "{}"}`).Code)
+	require.Equal(t, http.StatusOK, do(bob, "req-2", http.MethodPatch, "/banner/1", `{"content": "{\"title\": \"new\"}", "is_active": true, "tag_ids": [1, 2]}`).Code)
+	require.Equal(t, http.StatusNoContent, do(alice, "req-3", http.MethodDelete, "/banner/1", "").Code)
+
+	all := records("/audit")
+	require.Len(t, all, 3)
+	deleted, updated, created := all[0], all[1], all[2]
+
+	assert.Equal(t, models.AuditCreate, created.Action)
+	assert.Equal(t, "alice", created.Actor)
+	assert.Equal(t, "req-1", created.RequestId)
+	assert.Equal(t, 1, created.BannerId)
+	assert.Nil(t, created.Changes["feature_id"].Before)
+	assert.EqualValues(t, 1, created.Changes["feature_id"].After)
+
+	// в изменении только измененные поля, порядок тэгов не важен
+	assert.Equal(t, models.AuditUpdate, updated.Action)
+	assert.Equal(t, "bob", updated.Actor)
+	assert.Equal(t, "req-2", updated.RequestId)
+	assert.Equal(t, map[string]models.FieldChange{
+		"content":   {Before: "{}", After: `{"title": "new"}`},
+		"is_active": {Before: false, After: true},
+	}, updated.Changes)
+
+	assert.Equal(t, models.AuditDelete, deleted.Action)
+	assert.Nil(t, deleted.Changes["content"].After)
+
+	assert.Len(t, records("/audit?actor=bob"), 1)
+	assert.Len(t, records("/audit?banner_id=1"), 3)
+	assert.Empty(t, records("/audit?banner_id=2"))
+	assert.Empty(t, records("/audit?from="+time.Now().Add(time.Hour).Format(time.RFC3339)))
+	assert.Len(t, records("/audit?to="+time.Now().Add(time.Hour).Format(time.RFC3339)), 3)
+
+	assert.Equal(t, http.StatusBadRequest, do(alice, "", http.MethodGet, "/audit?from=yesterday", "").Code)
+	assert.Equal(t, http.StatusForbidden, do(bob, "", http.MethodGet, "/audit", "").Code)
+}
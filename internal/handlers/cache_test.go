@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+func TestCacheUnavailable(t *testing.T) {
+	h := newTestHandler(t)
+	h.createBanner(models.CreateBannerInput{FeatureId: 100, TagIds: []int{100}, Content: `{"title":"cached"}`, IsActive: true})
+	token := h.roleToken(rbac.RoleUser)
+
+	for _, cacheErr := range []error{errors.New("connection refused"), storage.ErrUnavailable} {
+		h.cache.err = cacheErr
+
+		// ошибки кэша считаются промахами, баннеры отдаются из базы
+		recorder := h.do(token, http.MethodGet, "/user_banner?feature_id=100&tag_id=100", "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"title":"cached"}`, recorder.Body.String())
+
+		recorder = h.do(token, http.MethodPost, "/user_banners", `{"feature_ids":[100,101],"tag_id":100}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"100":{"title":"cached"}}`, recorder.Body.String())
+	}
+}
+
+func TestStaleBanner(t *testing.T) {
+	h := newTestHandler(t)
+	for _, featureId := range []int{100, 101} {
+		h.createBanner(models.CreateBannerInput{FeatureId: featureId, TagIds: []int{100}, Content: `{"title":"good"}`, IsActive: true})
+	}
+	token := h.roleToken(rbac.RoleUser)
+	get := func(url string) *httptest.ResponseRecorder {
+		return h.do(token, http.MethodGet, url, "")
+	}
+
+	recorder := get("/user_banner?feature_id=100&tag_id=100")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Warning"))
+
+	// срок кэша истек и база недоступна, отдается последняя известная версия
+	h.cache.expire()
+	h.database.setErr(errors.New("connection refused"))
+	recorder = get("/user_banner?feature_id=100&tag_id=100")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"title":"good"}`, recorder.Body.String())
+	assert.Equal(t, StaleWarning, recorder.Header().Get("Warning"))
+
+	// баннер, который не отдавался, и запрос последней версии требуют базы
+	assert.Equal(t, http.StatusInternalServerError, get("/user_banner?feature_id=101&tag_id=100").Code)
+	assert.Equal(t, http.StatusInternalServerError, get("/user_banner?feature_id=100&tag_id=100&use_last_revision=true").Code)
+
+	// пакетный запрос отдает последние известные версии найденных баннеров
+	batch := func(body string) *httptest.ResponseRecorder {
+		return h.do(token, http.MethodPost, "/user_banners", body)
+	}
+	recorder = batch(`{"feature_ids":[100,101],"tag_id":100}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"100":{"title":"good"}}`, recorder.Body.String())
+	assert.Equal(t, StaleWarning, recorder.Header().Get("Warning"))
+	assert.Equal(t, http.StatusInternalServerError, batch(`{"feature_ids":[101],"tag_id":100}`).Code)
+	assert.Equal(t, http.StatusInternalServerError, batch(`{"feature_ids":[100],"tag_id":100,"use_last_revision":true}`).Code)
+
+	h.database.setErr(nil)
+	recorder = get("/user_banner?feature_id=100&tag_id=100")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Warning"))
+
+	// после выключения баннера его последняя версия не отдается при недоступной базе
+	isActive := false
+	require.NoError(t, h.ctrl.UpdateBanner(context.Background(), &models.UpdateBannerInput{Id: 1, IsActive: &isActive}))
+	h.database.setErr(errors.New("connection refused"))
+	assert.Equal(t, http.StatusInternalServerError, get("/user_banner?feature_id=100&tag_id=100").Code)
+	h.database.setErr(nil)
+
+	// так же после удаления
+	assert.Equal(t, http.StatusOK, get("/user_banner?feature_id=101&tag_id=100").Code)
+	require.NoError(t, h.ctrl.DeleteBanner(context.Background(), 2))
+	h.database.setErr(errors.New("connection refused"))
+	assert.Equal(t, http.StatusInternalServerError, get("/user_banner?feature_id=101&tag_id=100").Code)
+}
+
+func TestWarmUpCache(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+	h.createBanner(models.CreateBannerInput{FeatureId: 1, TagIds: []int{1, 2}, Content: `{}`, IsActive: true})
+	h.createBanner(models.CreateBannerInput{FeatureId: 2, TagIds: []int{1}, Content: `{}`, IsActive: true})
+	h.createBanner(models.CreateBannerInput{FeatureId: 3, TagIds: []int{1}, Content: `{}`})
+
+	count, err := h.ctrl.WarmUpCache(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	h.cache.expire()
+
+	token := h.roleToken(rbac.RoleOwner)
+	assert.Equal(t, http.StatusBadRequest, h.do(token, http.MethodPost, "/cache/warmup?limit=-1", "").Code)
+	assert.Equal(t, http.StatusAccepted, h.do(token, http.MethodPost, "/cache/warmup", "").Code)
+
+	// кэшируются только активные баннеры, для каждого тэга
+	assert.Eventually(t, func() bool {
+		return h.cache.cached(1, 1) && h.cache.cached(1, 2) && h.cache.cached(2, 1)
+	}, time.Second, time.Millisecond)
+	assert.False(t, h.cache.cached(3, 1))
+}
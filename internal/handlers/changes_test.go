@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+// readEvent reads one SSE event as a list of its lines.
+func readEvent(t *testing.T, reader *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestGetBannerChanges(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	server := httptest.NewUnstartedServer(h)
+	// поток должен переживать ограничение времени записи ответа
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	bannerId := h.createBanner(models.CreateBannerInput{FeatureId: 1, TagIds: []int{1, 2}, Content: `{}`})
+	isActive := true
+	err := h.ctrl.UpdateBanner(ctx, &models.UpdateBannerInput{Id: bannerId, IsActive: &isActive})
+	require.NoError(t, err)
+
+	requestCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	request, err := http.NewRequestWithContext(requestCtx, http.MethodGet, server.URL+"/banner/changes", nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+h.roleToken(rbac.RoleUser))
+	request.Header.Set("Last-Event-ID", "1-1")
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(response.Body)
+
+	// resumed after the first (created) event
+	event := readEvent(t, reader)
+	require.Len(t, event, 3)
+	require.Equal(t, "id: 2-2", event[0])
+	require.Equal(t, "event: updated", event[1])
+	require.Contains(t, event[2], `"banner_id":1,"feature_id":1,"tag_ids":[1,2]`)
+
+	// live event
+	time.Sleep(3 * server.Config.WriteTimeout)
+	err = h.ctrl.DeleteBanner(ctx, bannerId)
+	require.NoError(t, err)
+
+	event = readEvent(t, reader)
+	require.Len(t, event, 3)
+	require.Equal(t, "id: 3-3", event[0])
+	require.Equal(t, "event: deleted", event[1])
+}
+
+func TestBannerChangesFeatureScope(t *testing.T) {
+	h := newTestHandler(t)
+	h.createBanner(models.CreateBannerInput{FeatureId: 1, TagIds: []int{1}, Content: `{}`})
+	h.createBanner(models.CreateBannerInput{FeatureId: 2, TagIds: []int{1}, Content: `{}`})
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	get := func(lastEventId string) *http.Response {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/banner/changes", nil)
+		require.NoError(t, err)
+		token := h.token(utils.UserClaims{Role: rbac.RoleUser, Features: []int{2}})
+		request.Header.Set("Authorization", "Bearer "+token)
+		request.Header.Set("Last-Event-ID", lastEventId)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		return response
+	}
+
+	response := get("1")
+	response.Body.Close()
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response = get("0-0")
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	// изменения фич вне области токена не отдаются
+	event := readEvent(t, bufio.NewReader(response.Body))
+	require.Len(t, event, 3)
+	require.Equal(t, "id: 2-2", event[0])
+	require.Contains(t, event[2], `"feature_id":2`)
+}
+
+func TestBannerChangesStreamEndsOnShutdown(t *testing.T) {
+	h := newTestHandler(t)
+
+	server := httptest.NewUnstartedServer(h)
+	server.Config.RegisterOnShutdown(h.Shutdown)
+	server.Start()
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/banner/changes", nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+h.roleToken(rbac.RoleUser))
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	// открытый поток не задерживает остановку сервера до таймаута
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	started := time.Now()
+	require.NoError(t, server.Config.Shutdown(ctx))
+	require.Less(t, time.Since(started), time.Second)
+
+	_, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+}
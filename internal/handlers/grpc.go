@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/unbeman/av-banner-task/internal/controller"
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/pb"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/storage"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+// GrpcHandler implements gRPC banner service, mirrors HttpHandler.
+type GrpcHandler struct {
+	pb.UnimplementedBannerServiceServer
+	controller *controller.Controller
+	jwtManager *utils.JWTManager
+	policy     *rbac.Policy
+
+	rateLimiter RateLimiter // nil если ограничение запросов выключено
+	rateLimits  map[string]RateLimit
+}
+
+type GrpcHandlerOption func(h *GrpcHandler)
+
+// WithGrpcRateLimiter limits calls of each client by limits of route groups, same as WithRateLimiter.
+func WithGrpcRateLimiter(limiter RateLimiter, limits map[string]RateLimit) GrpcHandlerOption {
+	return func(h *GrpcHandler) {
+		h.rateLimiter = limiter
+		h.rateLimits = limits
+	}
+}
+
+func NewGrpcHandler(ctrl *controller.Controller, jwtManager *utils.JWTManager, policy *rbac.Policy, opts ...GrpcHandlerOption) (*GrpcHandler, error) {
+	h := &GrpcHandler{
+		controller: ctrl,
+		jwtManager: jwtManager,
+		policy:     policy,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+func (h GrpcHandler) GetUserBanner(ctx context.Context, request *pb.GetUserBannerRequest) (*pb.GetUserBannerResponse, error) {
+	input := &models.GetBannerInput{
+		TagId:           int(request.GetTagId()),
+		FeatureId:       int(request.GetFeatureId()),
+		UseLastRevision: request.GetUseLastRevision(),
+	}
+
+	out, stale, err := h.controller.GetBanner(ctx, input, activeFilter(ctx, h.policy))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if stale {
+		grpc.SetHeader(ctx, metadata.Pairs("warning", StaleWarning))
+	}
+	return &pb.GetUserBannerResponse{Content: string(*out)}, nil
+}
+
+func (h GrpcHandler) GetUserBanners(ctx context.Context, request *pb.GetUserBannersRequest) (*pb.GetUserBannersResponse, error) {
+	input := &models.GetUserBannersInput{
+		TagId:           int(request.GetTagId()),
+		FeatureIds:      toInts(request.GetFeatureIds()),
+		UseLastRevision: request.GetUseLastRevision(),
+	}
+	if err := input.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	out, stale, err := h.controller.GetUserBanners(ctx, input, activeFilter(ctx, h.policy))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if stale {
+		grpc.SetHeader(ctx, metadata.Pairs("warning", StaleWarning))
+	}
+
+	contents := make(map[int64]string, len(*out))
+	for featureId, content := range *out {
+		contents[int64(featureId)] = string(content)
+	}
+	return &pb.GetUserBannersResponse{Contents: contents}, nil
+}
+
+func (h GrpcHandler) ListBanners(ctx context.Context, request *pb.ListBannersRequest) (*pb.ListBannersResponse, error) {
+	input := &models.GetBannersInput{
+		TagId:     toIntPtr(request.TagId),
+		FeatureId: toIntPtr(request.FeatureId),
+		Limit:     toIntPtr(request.Limit),
+		Offset:    toIntPtr(request.Offset),
+	}
+
+	out, err := h.controller.GetBanners(ctx, input)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	banners := make([]*pb.Banner, 0, len(*out))
+	for _, banner := range *out {
+		banners = append(banners, &pb.Banner{
+			BannerId:  int64(banner.Id),
+			FeatureId: int64(banner.FeatureId),
+			TagIds:    toInt64s(banner.TagIds),
+			Content:   banner.Content,
+			IsActive:  banner.IsActive,
+			CreatedAt: timestamppb.New(banner.CreatedAt),
+			UpdateAt:  timestamppb.New(banner.UpdateAt),
+		})
+	}
+	return &pb.ListBannersResponse{Banners: banners}, nil
+}
+
+func (h GrpcHandler) CreateBanner(ctx context.Context, request *pb.CreateBannerRequest) (*pb.CreateBannerResponse, error) {
+	input := &models.CreateBannerInput{
+		FeatureId: int(request.GetFeatureId()),
+		TagIds:    toInts(request.GetTagIds()),
+		Content:   request.GetContent(),
+		IsActive:  request.GetIsActive(),
+	}
+	if err := input.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if input.IsActive {
+		if err := h.checkPermission(ctx, rbac.PublishBanner); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := h.controller.CreateBanner(ctx, input)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.CreateBannerResponse{BannerId: int64(out.BannerId)}, nil
+}
+
+func (h GrpcHandler) UpdateBanner(ctx context.Context, request *pb.UpdateBannerRequest) (*emptypb.Empty, error) {
+	input := &models.UpdateBannerInput{
+		Id:        int(request.GetBannerId()),
+		FeatureId: toIntPtr(request.FeatureId),
+		Content:   request.Content,
+		IsActive:  request.IsActive,
+	}
+	if request.TagIds != nil {
+		tagIds := toInts(request.TagIds.GetValues())
+		input.TagIds = &tagIds
+	}
+	if err := input.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if input.IsActive != nil {
+		if err := h.checkPermission(ctx, rbac.PublishBanner); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := h.controller.UpdateBanner(ctx, input); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (h GrpcHandler) DeleteBanner(ctx context.Context, request *pb.DeleteBannerRequest) (*emptypb.Empty, error) {
+	if err := h.controller.DeleteBanner(ctx, int(request.GetBannerId())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// grpcError maps storage and access errors to gRPC status codes.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, rbac.ErrFeatureOutOfScope):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func toInts(values []int64) []int {
+	ints := make([]int, len(values))
+	for i, value := range values {
+		ints[i] = int(value)
+	}
+	return ints
+}
+
+func toInt64s(values []int) []int64 {
+	ints := make([]int64, len(values))
+	for i, value := range values {
+		ints[i] = int64(value)
+	}
+	return ints
+}
+
+func toIntPtr(value *int64) *int {
+	if value == nil {
+		return nil
+	}
+	v := int(*value)
+	return &v
+}
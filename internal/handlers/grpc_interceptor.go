@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/unbeman/av-banner-task/internal/logging"
+	"github.com/unbeman/av-banner-task/internal/pb"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/storage"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+// grpcMethodPermissions are permissions required to call methods, mirrors routes of HttpHandler.
+var grpcMethodPermissions = map[string]rbac.Permission{
+	pb.BannerService_GetUserBanner_FullMethodName:  rbac.ReadUserBanner,
+	pb.BannerService_GetUserBanners_FullMethodName: rbac.ReadUserBanner,
+	pb.BannerService_ListBanners_FullMethodName:    rbac.ListBanners,
+	pb.BannerService_CreateBanner_FullMethodName:   rbac.CreateBanner,
+	pb.BannerService_UpdateBanner_FullMethodName:   rbac.UpdateBanner,
+	pb.BannerService_DeleteBanner_FullMethodName:   rbac.DeleteBanner,
+}
+
+// grpcMethodRateLimits are route groups of user methods, the rest of methods are in RateLimitAdmin group.
+var grpcMethodRateLimits = map[string]string{
+	pb.BannerService_GetUserBanner_FullMethodName:  RateLimitUser,
+	pb.BannerService_GetUserBanners_FullMethodName: RateLimitUser,
+}
+
+// RequestIDMetadata is a metadata key with request id, incoming id is kept if it's valid and returned in header.
+const RequestIDMetadata = "x-request-id"
+
+// Logging is a unary interceptor which puts request id and method to log fields of the call and logs the call.
+// It should be the first interceptor, so its fields are logged by the following ones.
+func (h GrpcHandler) Logging(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	requestID := logging.NormalizeRequestID(getMetadataValue(ctx, RequestIDMetadata))
+	// ошибка возможна, только если ответ уже отправлен
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadata, requestID))
+	ctx = logging.WithRequestID(ctx, requestID)
+	logging.AddFields(ctx, log.Fields{logging.FieldRoute: info.FullMethod})
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	entry := logging.FromContext(ctx).WithFields(log.Fields{
+		"code":        code.String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	switch code {
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		entry.WithError(err).Error("call failed")
+	default:
+		entry.Info("call handled")
+	}
+	return resp, err
+}
+
+// Authorization is a unary interceptor which verifies API key from "x-api-key" metadata or JWT token
+// from "authorization" metadata and checks permission of principal's role for the called method.
+func (h GrpcHandler) Authorization(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	principal, actor, err := h.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	permission, ok := grpcMethodPermissions[info.FullMethod]
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "unknown method")
+	}
+	if err = h.policy.Check(principal, permission); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	ctx = withActor(ctx, actor)
+	return handler(rbac.WithPrincipal(ctx, principal), req)
+}
+
+// IPRateLimit is a unary interceptor which limits calls from each client address, it should precede Authorization.
+func (h GrpcHandler) IPRateLimit(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := h.checkRateLimit(ctx, RateLimitIP, peerIPKey(ctx)); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// RateLimit is a unary interceptor which limits calls of each client to the route group of the method,
+// it should follow Authorization.
+func (h GrpcHandler) RateLimit(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	group, ok := grpcMethodRateLimits[info.FullMethod]
+	if !ok {
+		group = RateLimitAdmin
+	}
+	if err := h.checkRateLimit(ctx, group, actorRateLimitKey(ctx, peerIPKey(ctx))); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (h GrpcHandler) checkRateLimit(ctx context.Context, group string, key string) error {
+	limit := h.rateLimits[group]
+	if h.rateLimiter == nil || !limit.enabled() {
+		return nil
+	}
+	if allowed, retryAfter := allowRequest(ctx, h.rateLimiter, group, limit, key); !allowed {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfterSeconds(retryAfter)))
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// authenticate returns principal of API key or token from metadata and its identity for audit.
+func (h GrpcHandler) authenticate(ctx context.Context) (*rbac.Principal, string, error) {
+	if key := getMetadataValue(ctx, "x-api-key"); key != "" {
+		apiKey, err := h.controller.AuthenticateAPIKey(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, "", status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		if err != nil {
+			return nil, "", status.Error(codes.Internal, err.Error())
+		}
+		principal, err := principalFromAPIKey(h.policy, apiKey)
+		if err != nil {
+			return nil, "", status.Error(codes.PermissionDenied, err.Error())
+		}
+		return principal, apiKeyActor(apiKey), nil
+	}
+
+	userClaims, err := h.jwtManager.Verify(getTokenFromMetadata(ctx))
+	if errors.Is(err, utils.ErrInvalidToken) {
+		return nil, "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, "", status.Error(codes.Internal, err.Error())
+	}
+	revoked, err := h.controller.IsTokenRevoked(ctx, userClaims.Id, userClaims.Expiration())
+	if err != nil {
+		return nil, "", status.Error(codes.Internal, err.Error())
+	}
+	if revoked {
+		return nil, "", status.Error(codes.Unauthenticated, errTokenRevoked.Error())
+	}
+	principal, err := principalFromClaims(h.policy, userClaims)
+	if err != nil {
+		return nil, "", status.Error(codes.PermissionDenied, err.Error())
+	}
+	return principal, tokenActor(userClaims, principal), nil
+}
+
+func (h GrpcHandler) checkPermission(ctx context.Context, permission rbac.Permission) error {
+	principal, _ := rbac.PrincipalFromContext(ctx)
+	if err := h.policy.Check(principal, permission); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+func getMetadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func peerIPKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return addrIPKey("")
+	}
+	return addrIPKey(p.Addr.String())
+}
+
+func getTokenFromMetadata(ctx context.Context) string {
+	splitToken := strings.Split(getMetadataValue(ctx, "authorization"), " ")
+	if len(splitToken) == 2 {
+		return splitToken[1]
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/unbeman/av-banner-task/internal/pb"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+type GrpcSuite struct {
+	suite.Suite
+	jwtManager *utils.JWTManager
+	server     *grpc.Server
+	conn       *grpc.ClientConn
+	client     pb.BannerServiceClient
+}
+
+func (s *GrpcSuite) SetupTest() {
+	s.start()
+}
+
+// start serves handler with given options, the same way as gRPC server of the application.
+func (s *GrpcSuite) start(opts ...GrpcHandlerOption) {
+	env := newTestHandler(s.T())
+	s.jwtManager = env.jwtManager
+
+	handler, err := NewGrpcHandler(env.ctrl, env.jwtManager, rbac.DefaultPolicy(), opts...)
+	s.Require().NoError(err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	s.server = grpc.NewServer(grpc.ChainUnaryInterceptor(
+		handler.Logging,
+		handler.IPRateLimit,
+		handler.Authorization,
+		handler.RateLimit,
+	))
+	pb.RegisterBannerServiceServer(s.server, handler)
+	go s.server.Serve(listener)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	s.Require().NoError(err)
+	s.conn = conn
+	s.client = pb.NewBannerServiceClient(conn)
+}
+
+func (s *GrpcSuite) TearDownTest() {
+	s.conn.Close()
+	s.server.Stop()
+}
+
+func (s *GrpcSuite) withToken(role string) context.Context {
+	token, err := s.jwtManager.Generate(role)
+	s.Require().NoError(err)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func (s *GrpcSuite) createBanner(featureId int64, tagIds []int64, content string, isActive bool) int64 {
+	out, err := s.client.CreateBanner(s.withToken(rbac.RoleOwner), &pb.CreateBannerRequest{
+		FeatureId: featureId,
+		TagIds:    tagIds,
+		Content:   content,
+		IsActive:  isActive,
+	})
+	s.Require().NoError(err)
+	return out.GetBannerId()
+}
+
+func (s *GrpcSuite) TestAuthorization() {
+	s.Run("no token", func() {
+		_, err := s.client.GetUserBanner(context.Background(), &pb.GetUserBannerRequest{TagId: 1, FeatureId: 1})
+		s.Equal(codes.Unauthenticated, status.Code(err))
+	})
+
+	s.Run("invalid token", func() {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer invalid-token")
+		_, err := s.client.GetUserBanner(ctx, &pb.GetUserBannerRequest{TagId: 1, FeatureId: 1})
+		s.Equal(codes.Unauthenticated, status.Code(err))
+	})
+
+	s.Run("unknown role", func() {
+		_, err := s.client.GetUserBanner(s.withToken("unknown"), &pb.GetUserBannerRequest{TagId: 1, FeatureId: 1})
+		s.Equal(codes.PermissionDenied, status.Code(err))
+	})
+
+	s.Run("user token for admin method", func() {
+		_, err := s.client.ListBanners(s.withToken(rbac.RoleUser), &pb.ListBannersRequest{})
+		s.Equal(codes.PermissionDenied, status.Code(err))
+	})
+}
+
+func (s *GrpcSuite) TestGetUserBanner() {
+	s.createBanner(1, []int64{1, 2}, `{"title": "active"}`, true)
+	s.createBanner(2, []int64{1}, `{"title": "inactive"}`, false)
+
+	out, err := s.client.GetUserBanner(s.withToken(rbac.RoleUser), &pb.GetUserBannerRequest{TagId: 2, FeatureId: 1})
+	s.Require().NoError(err)
+	s.Equal(`{"title": "active"}`, out.GetContent())
+
+	_, err = s.client.GetUserBanner(s.withToken(rbac.RoleUser), &pb.GetUserBannerRequest{TagId: 1, FeatureId: 2})
+	s.Equal(codes.NotFound, status.Code(err))
+
+	out, err = s.client.GetUserBanner(s.withToken(rbac.RoleOwner), &pb.GetUserBannerRequest{TagId: 1, FeatureId: 2})
+	s.Require().NoError(err)
+	s.Equal(`{"title": "inactive"}`, out.GetContent())
+
+	batch, err := s.client.GetUserBanners(s.withToken(rbac.RoleUser), &pb.GetUserBannersRequest{TagId: 1, FeatureIds: []int64{1, 2, 3}})
+	s.Require().NoError(err)
+	s.Equal(map[int64]string{1: `{"title": "active"}`}, batch.GetContents())
+}
+
+func (s *GrpcSuite) TestBannerLifecycle() {
+	id := s.createBanner(1, []int64{1}, `{"title": "first"}`, true)
+
+	_, err := s.client.CreateBanner(s.withToken(rbac.RoleOwner), &pb.CreateBannerRequest{FeatureId: 1, TagIds: []int64{1}, Content: `{}`})
+	s.Equal(codes.AlreadyExists, status.Code(err))
+
+	_, err = s.client.CreateBanner(s.withToken(rbac.RoleOwner), &pb.CreateBannerRequest{FeatureId: 3, TagIds: []int64{1, 1}, Content: `{}`})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+
+	content := `{"title": "updated"}`
+	_, err = s.client.UpdateBanner(s.withToken(rbac.RoleOwner), &pb.UpdateBannerRequest{
+		BannerId: id,
+		TagIds:   &pb.TagIds{Values: []int64{4, 5}},
+		Content:  &content,
+	})
+	s.Require().NoError(err)
+
+	featureId := int64(1)
+	list, err := s.client.ListBanners(s.withToken(rbac.RoleOwner), &pb.ListBannersRequest{FeatureId: &featureId})
+	s.Require().NoError(err)
+	s.Require().Len(list.GetBanners(), 1)
+	s.Equal(content, list.GetBanners()[0].GetContent())
+	s.Equal([]int64{4, 5}, list.GetBanners()[0].GetTagIds())
+
+	_, err = s.client.UpdateBanner(s.withToken(rbac.RoleOwner), &pb.UpdateBannerRequest{BannerId: 100, Content: &content})
+	s.Equal(codes.NotFound, status.Code(err))
+
+	_, err = s.client.DeleteBanner(s.withToken(rbac.RoleOwner), &pb.DeleteBannerRequest{BannerId: id})
+	s.Require().NoError(err)
+
+	_, err = s.client.DeleteBanner(s.withToken(rbac.RoleOwner), &pb.DeleteBannerRequest{BannerId: id})
+	s.Equal(codes.NotFound, status.Code(err))
+}
+
+func (s *GrpcSuite) TestRateLimit() {
+	s.TearDownTest()
+	s.start(WithGrpcRateLimiter(NewMemoryRateLimiter(), map[string]RateLimit{
+		RateLimitIP:    {Rate: 0.5, Burst: 5},
+		RateLimitUser:  {Rate: 0.5, Burst: 2},
+		RateLimitAdmin: {Rate: 0.5, Burst: 1},
+	}))
+
+	userCtx := s.withToken(rbac.RoleUser)
+	for i := 0; i < 2; i++ {
+		_, err := s.client.GetUserBanner(userCtx, &pb.GetUserBannerRequest{TagId: 1, FeatureId: 1})
+		s.Equal(codes.NotFound, status.Code(err))
+	}
+	var header metadata.MD
+	_, err := s.client.GetUserBanner(userCtx, &pb.GetUserBannerRequest{TagId: 1, FeatureId: 1}, grpc.Header(&header))
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+	s.Equal([]string{"2"}, header.Get("retry-after"))
+
+	// у методов управления отдельный лимит
+	ownerCtx := s.withToken(rbac.RoleOwner)
+	_, err = s.client.ListBanners(ownerCtx, &pb.ListBannersRequest{})
+	s.Require().NoError(err)
+	_, err = s.client.ListBanners(ownerCtx, &pb.ListBannersRequest{})
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+
+	// лимит адреса проверяется до токена
+	_, err = s.client.GetUserBanner(context.Background(), &pb.GetUserBannerRequest{TagId: 1, FeatureId: 1})
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+}
+
+func TestGrpcSuite(t *testing.T) {
+	suite.Run(t, new(GrpcSuite))
+}
@@ -1,54 +1,155 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"sync"
+	"time"
 
-	"github.com/chi-middleware/logrus-logger"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	log "github.com/sirupsen/logrus"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 
 	_ "github.com/unbeman/av-banner-task/docs"
 	"github.com/unbeman/av-banner-task/internal/controller"
+	"github.com/unbeman/av-banner-task/internal/health"
+	"github.com/unbeman/av-banner-task/internal/logging"
 	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
 	"github.com/unbeman/av-banner-task/internal/storage"
 	"github.com/unbeman/av-banner-task/internal/utils"
 )
 
-const BannerIDParam = "id"
+const (
+	BannerIDParam  = "id"
+	WebhookIDParam = "id"
+	APIKeyIDParam  = "id"
+)
+
+// DefaultMaxBodySize is a default limit of banner create and update requests body.
+const DefaultMaxBodySize = 1 << 20
+
+// StaleWarning is a Warning header value of responses with last known good copy of banner served while database is unavailable.
+const StaleWarning = `110 - "Response is Stale"`
+
+const (
+	bannerChangesBatchSize = 100
+	// bannerChangesPollInterval is used to pick up changes recorded by other service replicas.
+	bannerChangesPollInterval = time.Second
+)
 
 type HttpHandler struct {
 	*chi.Mux
-	controller *controller.Controller
-	jwtManager *utils.JWTManager
+	controller  *controller.Controller
+	jwtManager  *utils.JWTManager
+	policy      *rbac.Policy
+	rateLimiter RateLimiter // nil если ограничение запросов выключено
+	rateLimits  map[string]RateLimit
+	tokenMaxTTL time.Duration   // 0 если выдача токенов выключена
+	tokenRoles  []string        // роли, токены которых можно выдать
+	health      *health.Checker // nil если проверки не заданы
+	maxBodySize int64           // ограничение тела запросов создания и изменения баннеров
+
+	shutdown     chan struct{} // закрывается при остановке сервера, завершая потоки изменений
+	shutdownOnce *sync.Once
+}
+
+type HttpHandlerOption func(h *HttpHandler)
+
+// WithRateLimiter limits requests of each client to route groups (RateLimitIP, RateLimitUser, RateLimitAdmin) by given limits.
+func WithRateLimiter(limiter RateLimiter, limits map[string]RateLimit) HttpHandlerOption {
+	return func(h *HttpHandler) {
+		h.rateLimiter = limiter
+		h.rateLimits = limits
+	}
 }
 
-func NewHttpHandler(ctrl *controller.Controller, jwtManager *utils.JWTManager) (*HttpHandler, error) {
+// WithTokenIssuing enables POST /auth/token issuing tokens of given roles with lifetime up to maxTTL without authorization.
+// It's intended for development and testing only.
+func WithTokenIssuing(maxTTL time.Duration, roles []string) HttpHandlerOption {
+	return func(h *HttpHandler) {
+		h.tokenMaxTTL = maxTTL
+		h.tokenRoles = roles
+	}
+}
+
+// WithMaxBodySize limits size of banner create and update requests body, DefaultMaxBodySize is used by default.
+func WithMaxBodySize(size int64) HttpHandlerOption {
+	return func(h *HttpHandler) {
+		h.maxBodySize = size
+	}
+}
+
+// WithHealthChecker registers liveness /healthz and readiness /readyz probes without authorization.
+func WithHealthChecker(checker *health.Checker) HttpHandlerOption {
+	return func(h *HttpHandler) {
+		h.health = checker
+	}
+}
+
+func NewHttpHandler(ctrl *controller.Controller, jwtManager *utils.JWTManager, policy *rbac.Policy, opts ...HttpHandlerOption) (*HttpHandler, error) {
 	h := &HttpHandler{
-		Mux:        chi.NewMux(),
-		controller: ctrl,
-		jwtManager: jwtManager,
+		Mux:         chi.NewMux(),
+		controller:  ctrl,
+		jwtManager:  jwtManager,
+		policy:      policy,
+		maxBodySize: DefaultMaxBodySize,
+
+		shutdown:     make(chan struct{}),
+		shutdownOnce: &sync.Once{},
 	}
-	h.Use(logger.Logger("router", log.StandardLogger()))
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.Use(h.requestID)
+	h.Use(h.metrics)
+	h.Use(h.tracing)
+	h.Use(h.logging)
 	h.Get("/swagger/*", httpSwagger.Handler()) // todo: переместить
+	if h.health != nil {
+		h.Get("/healthz", h.health.Liveness)
+		h.Get("/readyz", h.health.Readiness)
+	}
+	if h.tokenMaxTTL > 0 {
+		h.With(h.rateLimit(RateLimitAdmin, rateLimitKey)).Post("/auth/token", h.IssueToken)
+	}
 	h.Route("/", func(router chi.Router) {
+		router.Use(h.rateLimit(RateLimitIP, clientIPKey))
+		router.Use(h.authorization)
 		router.Group(func(userRouter chi.Router) {
-			userRouter.Use(h.userAuthorization)
-			userRouter.Get("/user_banner", h.GetUserBanner)
+			userRouter.Use(h.rateLimit(RateLimitUser, rateLimitKey))
+			userRouter.With(h.permission(rbac.ReadUserBanner)).Get("/user_banner", h.GetUserBanner)
+			userRouter.With(h.permission(rbac.ReadUserBanner)).Post("/user_banners", h.GetUserBanners)
+			userRouter.With(h.permission(rbac.ReadUserBanner)).Get("/banner/changes", h.GetBannerChanges)
 		})
 		router.Group(func(adminRouter chi.Router) {
-			adminRouter.Use(h.adminAuthorization)
-			adminRouter.Get("/banner", h.GetBanners)
-			adminRouter.Post("/banner", h.CreateBanner)
-			adminRouter.Patch("/banner/{id}", h.UpdateBanner)
-			adminRouter.Delete("/banner/{id}", h.DeleteBanner)
+			adminRouter.Use(h.rateLimit(RateLimitAdmin, rateLimitKey))
+			adminRouter.With(h.permission(rbac.ListBanners)).Get("/banner", h.GetBanners)
+			// включение баннера дополнительно требует banner:publish, проверяется в обработчиках
+			adminRouter.With(h.permission(rbac.CreateBanner), h.limitBody).Post("/banner", h.CreateBanner)
+			adminRouter.With(h.permission(rbac.UpdateBanner), h.limitBody).Patch("/banner/{id}", h.UpdateBanner)
+			adminRouter.With(h.permission(rbac.DeleteBanner)).Delete("/banner/{id}", h.DeleteBanner)
+			adminRouter.Group(func(webhookRouter chi.Router) {
+				webhookRouter.Use(h.permission(rbac.ManageWebhooks))
+				webhookRouter.Get("/webhooks", h.GetWebhooks)
+				webhookRouter.Post("/webhooks", h.CreateWebhook)
+				webhookRouter.Delete("/webhooks/{id}", h.DeleteWebhook)
+				webhookRouter.Get("/webhooks/{id}/deliveries", h.GetWebhookDeliveries)
+			})
+			adminRouter.With(h.permission(rbac.RevokeTokens)).Post("/tokens/revoke", h.RevokeToken)
+			adminRouter.With(h.permission(rbac.ReadAudit)).Get("/audit", h.GetAuditRecords)
+			adminRouter.With(h.permission(rbac.WarmUpCache)).Post("/cache/warmup", h.WarmUpCache)
+			adminRouter.Group(func(apiKeyRouter chi.Router) {
+				apiKeyRouter.Use(h.permission(rbac.ManageAPIKeys))
+				apiKeyRouter.Get("/api_keys", h.GetAPIKeys)
+				apiKeyRouter.Post("/api_keys", h.CreateAPIKey)
+				apiKeyRouter.Delete("/api_keys/{id}", h.RevokeAPIKey)
+			})
 		})
-
 	})
 	return h, nil
 }
@@ -60,6 +161,7 @@ func NewHttpHandler(ctrl *controller.Controller, jwtManager *utils.JWTManager) (
 // @Param feature_id query integer true "Идентификатор фичи"
 // @Param tag_id query integer true "Идентификатор тэга"
 // @Success 200 {object} models.GetBannerOutput
+// @Header 200 {string} Warning "110 - \"Response is Stale\", если база недоступна и отдана последняя известная версия баннера"
 // @Failure 400 {object} models.ErrResponse
 // @Failure 401 {object} models.ErrResponse
 // @Failure 403 {object} models.ErrResponse
@@ -69,7 +171,6 @@ func NewHttpHandler(ctrl *controller.Controller, jwtManager *utils.JWTManager) (
 // @Router /user_banner [get]
 func (h HttpHandler) GetUserBanner(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
-	accessLevel := h.getAccessLevelFromContext(ctx)
 
 	input := &models.GetBannerInput{}
 	if err := input.FromURI(request); err != nil {
@@ -77,17 +178,7 @@ func (h HttpHandler) GetUserBanner(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	var out *models.GetBannerOutput
-	var err error
-
-	switch accessLevel {
-	case ADMIN:
-		out, err = h.controller.GetBanner(ctx, input, nil)
-	case USER:
-		isActive := true
-		out, err = h.controller.GetBanner(ctx, input, &isActive)
-	}
-
+	out, stale, err := h.controller.GetBanner(ctx, input, activeFilter(ctx, h.policy))
 	if errors.Is(err, storage.ErrNotFound) {
 		render.Render(writer, request, models.ErrNotFound(err))
 		return
@@ -96,9 +187,46 @@ func (h HttpHandler) GetUserBanner(writer http.ResponseWriter, request *http.Req
 		render.Render(writer, request, models.ErrInternalServerError(err))
 		return
 	}
+	if stale {
+		writer.Header().Set("Warning", StaleWarning)
+	}
 	render.JSON(writer, request, json.RawMessage(*out))
 }
 
+// GetUserBanners godoc
+// @Summary Получение баннеров для набора фич
+// @Description Возвращает баннеры по заданному tag_id для каждой из feature_ids (не более 100). Фичи, для которых баннер не найден, отсутствуют в ответе
+// @Accept json
+// @Produce json
+// @Param input body models.GetUserBannersInput true "Тэг и набор фич"
+// @Success 200 {object} map[string]object
+// @Header 200 {string} Warning "110 - \"Response is Stale\", если база недоступна и отданы последние известные версии баннеров"
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /user_banners [post]
+func (h HttpHandler) GetUserBanners(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	input := &models.GetUserBannersInput{}
+	if err := render.Bind(request, input); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+
+	out, stale, err := h.controller.GetUserBanners(ctx, input, activeFilter(ctx, h.policy))
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	if stale {
+		writer.Header().Set("Warning", StaleWarning)
+	}
+	render.JSON(writer, request, out)
+}
+
 // GetBanners godoc
 // @Summary Получение списка баннеров
 // @Description Возвращает список баннеров по заданной фильтрации feature_id и/или tag_id
@@ -142,16 +270,24 @@ func (h HttpHandler) GetBanners(writer http.ResponseWriter, request *http.Reques
 // @Failure 403 {object} models.ErrResponse
 // @Failure 404 {object} models.ErrResponse
 // @Failure 409 {object} models.ErrResponse
+// @Failure 413 {object} models.ErrResponse
 // @Failure 500 {object} models.ErrResponse
 // @Security Bearer
 // @Router /banner [post]
 func (h HttpHandler) CreateBanner(writer http.ResponseWriter, request *http.Request) {
 	input := &models.CreateBannerInput{}
 	if err := render.Bind(request, input); err != nil {
-		render.Render(writer, request, models.ErrBadRequest(err))
+		render.Render(writer, request, bindError(err))
+		return
+	}
+	if input.IsActive && !h.checkPermission(writer, request, rbac.PublishBanner) {
 		return
 	}
 	out, err := h.controller.CreateBanner(request.Context(), input)
+	if errors.Is(err, rbac.ErrFeatureOutOfScope) {
+		render.Render(writer, request, models.ErrForbidden(err))
+		return
+	}
 	if errors.Is(err, storage.ErrNotFound) {
 		render.Render(writer, request, models.ErrBadRequest(err))
 		return
@@ -181,6 +317,7 @@ func (h HttpHandler) CreateBanner(writer http.ResponseWriter, request *http.Requ
 // @Failure 403 {object} models.ErrResponse
 // @Failure 404 {object} models.ErrResponse
 // @Failure 409 {object} models.ErrResponse
+// @Failure 413 {object} models.ErrResponse
 // @Failure 500 {object} models.ErrResponse
 // @Security Bearer
 // @Router /banner/{id} [patch]
@@ -194,13 +331,20 @@ func (h HttpHandler) UpdateBanner(writer http.ResponseWriter, request *http.Requ
 	}
 
 	if err = render.Bind(request, input); err != nil {
-		render.Render(writer, request, models.ErrBadRequest(err))
+		render.Render(writer, request, bindError(err))
+		return
+	}
+	if input.IsActive != nil && !h.checkPermission(writer, request, rbac.PublishBanner) {
 		return
 	}
 
 	input.Id = bannerId
 
 	err = h.controller.UpdateBanner(request.Context(), input)
+	if errors.Is(err, rbac.ErrFeatureOutOfScope) {
+		render.Render(writer, request, models.ErrForbidden(err))
+		return
+	}
 	if errors.Is(err, storage.ErrNotFound) {
 		render.Render(writer, request, models.ErrNotFound(err))
 		return
@@ -237,6 +381,10 @@ func (h HttpHandler) DeleteBanner(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 	err = h.controller.DeleteBanner(request.Context(), bannerId)
+	if errors.Is(err, rbac.ErrFeatureOutOfScope) {
+		render.Render(writer, request, models.ErrForbidden(err))
+		return
+	}
 	if errors.Is(err, storage.ErrNotFound) {
 		render.Render(writer, request, models.ErrNotFound(err))
 		return
@@ -253,11 +401,482 @@ func (h HttpHandler) DeleteBanner(writer http.ResponseWriter, request *http.Requ
 	writer.WriteHeader(http.StatusNoContent)
 }
 
-func (h HttpHandler) getAccessLevelFromContext(ctx context.Context) int {
-	return ctx.Value(AccessContextKey).(int)
+// GetBannerChanges godoc
+// @Summary Поток изменений баннеров
+// @Description Отдает Server-Sent Events о создании, обновлении и удалении баннеров фич, доступных токену (события created, updated, deleted).
+// @Description При переданном Last-Event-ID поток продолжается с изменения, следующего за ним, иначе отдаются только новые изменения
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "Идентификатор последнего полученного события"
+// @Success 200 {object} models.BannerChange
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /banner/changes [get]
+func (h HttpHandler) GetBannerChanges(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		render.Render(writer, request, models.ErrInternalServerError(fmt.Errorf("streaming is not supported")))
+		return
+	}
+
+	var cursor models.BannerChangeCursor
+	var err error
+	if lastEventId := request.Header.Get("Last-Event-ID"); lastEventId != "" {
+		cursor, err = models.ParseBannerChangeCursor(lastEventId)
+		if err != nil {
+			render.Render(writer, request, models.ErrBadRequest(err))
+			return
+		}
+	} else {
+		cursor, err = h.controller.GetLastBannerChangeCursor(ctx)
+		if err != nil {
+			render.Render(writer, request, models.ErrInternalServerError(err))
+			return
+		}
+	}
+
+	notifications, unsubscribe := h.controller.SubscribeBannerChanges()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(bannerChangesPollInterval)
+	defer ticker.Stop()
+
+	// поток живет дольше WriteTimeout сервера, поэтому снимаем ограничение записи для этого запроса
+	http.NewResponseController(writer).SetWriteDeadline(time.Time{})
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		changes, err := h.controller.GetBannerChanges(ctx, cursor, bannerChangesBatchSize)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("couldn't get banner changes: %v", err)
+			return
+		}
+		for _, change := range changes {
+			if err = writeBannerChangeEvent(writer, change); err != nil {
+				return
+			}
+			cursor = change.Cursor()
+		}
+		flusher.Flush()
+
+		if len(changes) == bannerChangesBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.shutdown:
+			// клиент переподключится с Last-Event-ID к другому экземпляру
+			return
+		case <-notifications:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown ends open banner changes streams, which otherwise keep graceful shutdown of the server waiting.
+// It should be registered with http.Server.RegisterOnShutdown.
+func (h HttpHandler) Shutdown() {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+}
+
+func writeBannerChangeEvent(writer http.ResponseWriter, change *models.BannerChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %s\nevent: %s\ndata: %s\n\n", change.Cursor(), change.Event, data)
+	return err
+}
+
+// GetWebhooks godoc
+// @Summary Получение списка вебхуков
+// @Description Возвращает список подписок на события баннеров
+// @Produce json
+// @Success 200 {object} models.Webhooks
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /webhooks [get]
+func (h HttpHandler) GetWebhooks(writer http.ResponseWriter, request *http.Request) {
+	out, err := h.controller.GetWebhooks(request.Context())
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	render.JSON(writer, request, out)
+}
+
+// CreateWebhook godoc
+// @Summary Создание вебхука
+// @Description Подписывает URL на события баннеров (created, updated, activated, deactivated, deleted).
+// @Description Тело запроса подписывается HMAC-SHA256 с заданным секретом и передается в заголовке X-Webhook-Signature
+// @Accept json
+// @Produce json
+// @Param input body models.CreateWebhookInput true "Информация о вебхуке"
+// @Success 201 {object} models.CreateWebhookOutput
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /webhooks [post]
+func (h HttpHandler) CreateWebhook(writer http.ResponseWriter, request *http.Request) {
+	input := &models.CreateWebhookInput{}
+	if err := render.Bind(request, input); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+	out, err := h.controller.CreateWebhook(request.Context(), input)
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	render.Status(request, http.StatusCreated)
+	render.JSON(writer, request, out)
+}
+
+// DeleteWebhook godoc
+// @Summary Удаление вебхука
+// @Description Удаляет подписку вместе с журналом ее доставок
+// @Produce json
+// @Param id path integer true "Идентификатор вебхука"
+// @Success 204
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 404 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /webhooks/{id} [delete]
+func (h HttpHandler) DeleteWebhook(writer http.ResponseWriter, request *http.Request) {
+	webhookId, err := getWebhookIDFromURI(request)
+	if err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+	err = h.controller.DeleteWebhook(request.Context(), webhookId)
+	if errors.Is(err, storage.ErrNotFound) {
+		render.Render(writer, request, models.ErrNotFound(err))
+		return
+	}
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Журнал доставок вебхука
+// @Description Возвращает доставки событий вебхуку, начиная с последних
+// @Produce json
+// @Param id path integer true "Идентификатор вебхука"
+// @Param status query string false "Статус доставки" Enums(pending, delivered, failed)
+// @Param limit query integer false "Лимит выдачи"
+// @Param offset query integer false "Сдвиг выдачи"
+// @Success 200 {object} models.WebhookDeliveries
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /webhooks/{id}/deliveries [get]
+func (h HttpHandler) GetWebhookDeliveries(writer http.ResponseWriter, request *http.Request) {
+	webhookId, err := getWebhookIDFromURI(request)
+	if err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+
+	input := &models.GetWebhookDeliveriesInput{WebhookId: webhookId}
+	if err = input.FromURI(request); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+
+	out, err := h.controller.GetWebhookDeliveries(request.Context(), input)
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	render.JSON(writer, request, out)
+}
+
+// GetAPIKeys godoc
+// @Summary Получение списка API-ключей
+// @Description Возвращает API-ключи сервисов без самих ключей, включая отозванные
+// @Produce json
+// @Success 200 {object} models.APIKeys
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /api_keys [get]
+func (h HttpHandler) GetAPIKeys(writer http.ResponseWriter, request *http.Request) {
+	out, err := h.controller.GetAPIKeys(request.Context())
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	render.JSON(writer, request, out)
+}
+
+// CreateAPIKey godoc
+// @Summary Создание API-ключа
+// @Description Создает ключ сервиса с заданной ролью, ключ передается в заголовке X-API-Key.
+// @Description scopes сужают права роли, feature_ids - фичи, баннерами которых можно управлять. Ключ не может получить прав больше, чем у создателя.
+// @Description Ключ возвращается только в ответе на этот запрос
+// @Accept json
+// @Produce json
+// @Param input body models.CreateAPIKeyInput true "Информация о ключе"
+// @Success 201 {object} models.CreateAPIKeyOutput
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /api_keys [post]
+func (h HttpHandler) CreateAPIKey(writer http.ResponseWriter, request *http.Request) {
+	input := &models.CreateAPIKeyInput{}
+	if err := render.Bind(request, input); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+	if !h.policy.HasRole(input.Role) {
+		render.Render(writer, request, models.ErrBadRequest(fmt.Errorf("unknown role %s", input.Role)))
+		return
+	}
+	var scopes []rbac.Permission
+	if input.Scopes != nil {
+		scopes = make([]rbac.Permission, 0, len(input.Scopes))
+	}
+	for _, scope := range input.Scopes {
+		if !rbac.IsPermission(rbac.Permission(scope)) {
+			render.Render(writer, request, models.ErrBadRequest(fmt.Errorf("unknown permission %s", scope)))
+			return
+		}
+		scopes = append(scopes, rbac.Permission(scope))
+	}
+	principal, _ := rbac.PrincipalFromContext(request.Context())
+	if err := h.policy.CheckDelegation(principal, input.Role, scopes); err != nil {
+		render.Render(writer, request, models.ErrForbidden(err))
+		return
+	}
+
+	out, err := h.controller.CreateAPIKey(request.Context(), input)
+	if errors.Is(err, rbac.ErrFeatureOutOfScope) {
+		render.Render(writer, request, models.ErrForbidden(err))
+		return
+	}
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	render.Status(request, http.StatusCreated)
+	render.JSON(writer, request, out)
+}
+
+// RevokeAPIKey godoc
+// @Summary Отзыв API-ключа
+// @Description Отзывает ключ, запросы с ним перестают авторизовываться
+// @Produce json
+// @Param id path integer true "Идентификатор ключа"
+// @Success 204
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 404 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /api_keys/{id} [delete]
+func (h HttpHandler) RevokeAPIKey(writer http.ResponseWriter, request *http.Request) {
+	keyId, err := strconv.Atoi(chi.URLParam(request, APIKeyIDParam))
+	if err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+	err = h.controller.RevokeAPIKey(request.Context(), keyId)
+	if errors.Is(err, storage.ErrNotFound) {
+		render.Render(writer, request, models.ErrNotFound(err))
+		return
+	}
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeToken godoc
+// @Summary Отзыв токена
+// @Description Отзывает токен, переданный целиком или его jti. Отозванный токен не принимается до истечения срока действия.
+// @Description Другие реплики сервиса могут принимать токен еще до 5 секунд
+// @Accept json
+// @Produce json
+// @Param input body models.RevokeTokenInput true "Токен или его jti"
+// @Success 204
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /tokens/revoke [post]
+func (h HttpHandler) RevokeToken(writer http.ResponseWriter, request *http.Request) {
+	input := &models.RevokeTokenInput{}
+	if err := render.Bind(request, input); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+
+	jti, expiresAt := input.Jti, input.ExpiresAt
+	if input.Token != "" {
+		claims, err := h.jwtManager.Verify(input.Token)
+		if err != nil {
+			render.Render(writer, request, models.ErrBadRequest(err))
+			return
+		}
+		if claims.Id == "" {
+			render.Render(writer, request, models.ErrBadRequest(fmt.Errorf("token has no jti")))
+			return
+		}
+		jti, expiresAt = claims.Id, claims.Expiration()
+	}
+
+	if err := h.controller.RevokeToken(request.Context(), jti, expiresAt, input.Reason); err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetAuditRecords godoc
+// @Summary Журнал изменений баннеров
+// @Description Возвращает записи о создании, изменении и удалении баннеров, начиная с последних.
+// @Description Запись содержит автора изменения, идентификатор запроса и значения измененных полей до и после
+// @Produce json
+// @Param banner_id query integer false "Идентификатор баннера"
+// @Param actor query string false "Автор изменения"
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включается"
+// @Param limit query integer false "Лимит выдачи"
+// @Param offset query integer false "Сдвиг выдачи"
+// @Success 200 {object} models.AuditRecords
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /audit [get]
+func (h HttpHandler) GetAuditRecords(writer http.ResponseWriter, request *http.Request) {
+	input := &models.GetAuditInput{}
+	if err := input.FromURI(request); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+	out, err := h.controller.GetAuditRecords(request.Context(), input)
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	render.JSON(writer, request, out)
+}
+
+// IssueToken godoc
+// @Summary Выдача токена
+// @Description Выдает токен с заданными ролью, фичами, командами и временем жизни. Только для разработки и тестирования,
+// @Description включается переменной AUTH_TOKEN_ENDPOINT_ENABLED, выдаются только роли из AUTH_TOKEN_ROLES
+// @Accept json
+// @Produce json
+// @Param input body models.IssueTokenInput true "Claims токена"
+// @Success 200 {object} models.IssueTokenOutput
+// @Failure 400 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Router /auth/token [post]
+func (h HttpHandler) IssueToken(writer http.ResponseWriter, request *http.Request) {
+	input := &models.IssueTokenInput{}
+	if err := render.Bind(request, input); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+	if !h.policy.HasRole(input.Role) {
+		render.Render(writer, request, models.ErrBadRequest(fmt.Errorf("unknown role %s", input.Role)))
+		return
+	}
+	if !slices.Contains(h.tokenRoles, input.Role) {
+		render.Render(writer, request, models.ErrForbidden(fmt.Errorf("tokens of role %s are not issued", input.Role)))
+		return
+	}
+	ttl := input.Lifetime
+	if ttl == 0 {
+		ttl = h.jwtManager.TokenTTL()
+	}
+	if ttl > h.tokenMaxTTL {
+		render.Render(writer, request, models.ErrBadRequest(fmt.Errorf("ttl should not exceed %s", h.tokenMaxTTL)))
+		return
+	}
+
+	claims := utils.UserClaims{Role: input.Role, Features: input.Features, Teams: input.Teams}
+	claims.Subject = input.Subject
+	token, err := h.jwtManager.GenerateWithClaims(claims, ttl)
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	render.JSON(writer, request, &models.IssueTokenOutput{Token: token, ExpiresAt: time.Now().Add(ttl).Truncate(time.Second)})
+}
+
+// WarmUpCache godoc
+// @Summary Прогрев кэша
+// @Description Запускает в фоне загрузку активных баннеров в кэш, начиная с недавно измененных. Ход прогрева пишется в лог
+// @Produce json
+// @Param limit query integer false "Максимальное число баннеров, по умолчанию все"
+// @Success 202
+// @Failure 400 {object} models.ErrResponse
+// @Failure 401 {object} models.ErrResponse
+// @Failure 403 {object} models.ErrResponse
+// @Failure 409 {object} models.ErrResponse
+// @Failure 500 {object} models.ErrResponse
+// @Security Bearer
+// @Router /cache/warmup [post]
+func (h HttpHandler) WarmUpCache(writer http.ResponseWriter, request *http.Request) {
+	input := &models.WarmUpCacheInput{}
+	if err := input.FromURI(request); err != nil {
+		render.Render(writer, request, models.ErrBadRequest(err))
+		return
+	}
+	err := h.controller.StartWarmUpCache(request.Context(), input.Limit)
+	if errors.Is(err, controller.ErrWarmUpInProgress) {
+		render.Render(writer, request, models.ErrConflict(err))
+		return
+	}
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+	writer.WriteHeader(http.StatusAccepted)
 }
 
 func getBannerIDFromURI(request *http.Request) (int, error) {
 	rawID := chi.URLParam(request, BannerIDParam)
 	return strconv.Atoi(rawID)
 }
+
+func getWebhookIDFromURI(request *http.Request) (int, error) {
+	rawID := chi.URLParam(request, WebhookIDParam)
+	return strconv.Atoi(rawID)
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/unbeman/av-banner-task/internal/controller"
 	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
 	"github.com/unbeman/av-banner-task/internal/storage/pg"
 	"github.com/unbeman/av-banner-task/internal/storage/redis"
 	"github.com/unbeman/av-banner-task/internal/utils"
@@ -75,7 +76,7 @@ func (s *BannerSuite) SetupSuite() {
 	ctrl, err := controller.NewController(pg, redisManager)
 	s.Nil(err)
 
-	h, err := NewHttpHandler(ctrl, jwtManager)
+	h, err := NewHttpHandler(ctrl, jwtManager, rbac.DefaultPolicy())
 
 	s.router = h
 }
@@ -102,14 +103,14 @@ func (s *BannerSuite) TestGetUserBanner() {
 	url := "/user_banner"
 
 	type BannerTestCase struct {
-		role           int
+		role           string
 		input          models.GetBannerInput
 		expectedBanner models.Banner
 		expectedStatus int
 	}
 
 	activeBanner := BannerTestCase{
-		role: USER,
+		role: rbac.RoleUser,
 		input: models.GetBannerInput{
 			TagId:           1,
 			FeatureId:       1,
@@ -125,7 +126,7 @@ func (s *BannerSuite) TestGetUserBanner() {
 	}
 
 	inactiveBanner := BannerTestCase{
-		role: USER,
+		role: rbac.RoleUser,
 		input: models.GetBannerInput{
 			TagId:     3,
 			FeatureId: 2,
@@ -140,7 +141,7 @@ func (s *BannerSuite) TestGetUserBanner() {
 	}
 
 	activeCashedBanner := BannerTestCase{
-		role: USER,
+		role: rbac.RoleUser,
 		input: models.GetBannerInput{
 			TagId:     3,
 			FeatureId: 4,
@@ -155,7 +156,7 @@ func (s *BannerSuite) TestGetUserBanner() {
 	}
 
 	notFoundBanner := BannerTestCase{
-		role: USER,
+		role: rbac.RoleUser,
 		input: models.GetBannerInput{
 			TagId:           4,
 			FeatureId:       5,
@@ -172,7 +173,7 @@ func (s *BannerSuite) TestGetUserBanner() {
 
 	s.Run("Успешное получение активного баннера для пользователя 200 OK", func() {
 		testCase := activeBanner
-		testCase.role = USER
+		testCase.role = rbac.RoleUser
 
 		banner, err := s.database.CreateBanner(context.Background(), &testCase.expectedBanner)
 		defer func() {
@@ -198,7 +199,7 @@ func (s *BannerSuite) TestGetUserBanner() {
 
 	s.Run("Успешное получение активного баннера для админа 200 OK", func() {
 		testCase := activeBanner
-		testCase.role = ADMIN
+		testCase.role = rbac.RoleOwner
 
 		banner, err := s.database.CreateBanner(context.Background(), &testCase.expectedBanner)
 		defer func() {
@@ -223,7 +224,7 @@ func (s *BannerSuite) TestGetUserBanner() {
 
 	s.Run("Успешное получение неактивного баннера для админа 200 OK", func() {
 		testCase := inactiveBanner
-		testCase.role = ADMIN
+		testCase.role = rbac.RoleOwner
 
 		banner, err := s.database.CreateBanner(context.Background(), &testCase.expectedBanner)
 		defer func() {
@@ -386,7 +387,7 @@ func (s *BannerSuite) TestGetUserBanner() {
 
 	s.Run("Неудачное получение баннера пользователем - несуществующий тип пользователя 403 Forbidden", func() {
 		testCase := activeBanner
-		testCase.role = 42
+		testCase.role = "unknown"
 		testCase.expectedStatus = http.StatusForbidden
 
 		banner, err := s.database.CreateBanner(context.Background(), &testCase.expectedBanner)
@@ -411,11 +412,78 @@ func (s *BannerSuite) TestGetUserBanner() {
 
 }
 
+func (s *BannerSuite) TestGetUserBanners() {
+	url := "/user_banners"
+
+	activeBanner := models.Banner{
+		FeatureId: 6,
+		TagIds:    []int{6, 7},
+		Content:   `{"title": "Active banner"}`,
+		IsActive:  true,
+	}
+	inactiveBanner := models.Banner{
+		FeatureId: 7,
+		TagIds:    []int{6, 8},
+		Content:   `{"title": "Inactive banner"}`,
+		IsActive:  false,
+	}
+
+	ctx := context.Background()
+	active, err := s.database.CreateBanner(ctx, &activeBanner)
+	s.Nil(err)
+	inactive, err := s.database.CreateBanner(ctx, &inactiveBanner)
+	s.Nil(err)
+	defer func() {
+		s.Nil(s.database.DeleteBanner(ctx, active.Id))
+		s.Nil(s.database.DeleteBanner(ctx, inactive.Id))
+	}()
+
+	s.Run("Успешное получение баннеров для пользователя 200 OK", func() {
+		apitest.
+			New().
+			Handler(s.router).
+			Post(url).
+			Header(AuthorizationHeader, s.generateBearerToken(rbac.RoleUser)).
+			JSON(`{"tag_id": 6, "feature_ids": [6, 7, 8], "use_last_revision": true}`).
+			Expect(s.T()).
+			Header(ContentTypeHeader, JSONContentType).
+			Status(http.StatusOK).
+			Body(`{"6": {"title": "Active banner"}}`).
+			End()
+	})
+
+	s.Run("Успешное получение баннеров для админа 200 OK", func() {
+		apitest.
+			New().
+			Handler(s.router).
+			Post(url).
+			Header(AuthorizationHeader, s.generateBearerToken(rbac.RoleOwner)).
+			JSON(`{"tag_id": 6, "feature_ids": [6, 7], "use_last_revision": true}`).
+			Expect(s.T()).
+			Header(ContentTypeHeader, JSONContentType).
+			Status(http.StatusOK).
+			Body(`{"6": {"title": "Active banner"}, "7": {"title": "Inactive banner"}}`).
+			End()
+	})
+
+	s.Run("Неудачное получение баннеров - повторяющиеся фичи 400 Bad Request", func() {
+		apitest.
+			New().
+			Handler(s.router).
+			Post(url).
+			Header(AuthorizationHeader, s.generateBearerToken(rbac.RoleUser)).
+			JSON(`{"tag_id": 6, "feature_ids": [6, 6]}`).
+			Expect(s.T()).
+			Status(http.StatusBadRequest).
+			End()
+	})
+}
+
 func TestSuite(t *testing.T) {
 	suite.Run(t, new(BannerSuite))
 }
 
-func (s *BannerSuite) generateBearerToken(role int) string {
+func (s *BannerSuite) generateBearerToken(role string) string {
 	token, err := s.jwtManager.Generate(role)
 	s.Nil(err)
 	return "Bearer " + token
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/controller"
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+const testSecretKey = "test-secret-key"
+
+// testHandler is HTTP handler over fake storages shared by handler tests.
+type testHandler struct {
+	*HttpHandler
+	t          *testing.T
+	jwtManager *utils.JWTManager
+	database   *fakeDatabase
+	cache      *fakeCache
+	ctrl       *controller.Controller
+}
+
+type testHandlerConfig struct {
+	database    *fakeDatabase
+	cache       *fakeCache
+	policy      *rbac.Policy
+	handlerOpts []HttpHandlerOption
+}
+
+type testHandlerOption func(c *testHandlerConfig)
+
+// withStorages makes handler use given storages, e.g. to emulate another replica of the service.
+
+func withStorages(database *fakeDatabase, cache *fakeCache) testHandlerOption {
+	return func(c *testHandlerConfig) {
+		c.database = database
+		c.cache = cache
+	}
+}
+
+func withPolicy(policy *rbac.Policy) testHandlerOption {
+	return func(c *testHandlerConfig) {
+		c.policy = policy
+	}
+}
+
+func withHandlerOptions(opts ...HttpHandlerOption) testHandlerOption {
+	return func(c *testHandlerConfig) {
+		c.handlerOpts = append(c.handlerOpts, opts...)
+	}
+}
+
+func newTestHandler(t *testing.T, opts ...testHandlerOption) *testHandler {
+	config := testHandlerConfig{policy: rbac.DefaultPolicy()}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.database == nil {
+		config.database, config.cache = newFakeDatabase(), newFakeCache()
+	}
+
+	jwtManager, err := utils.NewJWTManager(testSecretKey)
+	require.NoError(t, err)
+	ctrl, err := controller.NewController(config.database, config.cache)
+	require.NoError(t, err)
+	handler, err := NewHttpHandler(ctrl, jwtManager, config.policy, config.handlerOpts...)
+	require.NoError(t, err)
+	return &testHandler{
+		HttpHandler: handler,
+		t:           t,
+		jwtManager:  jwtManager,
+		database:    config.database,
+		cache:       config.cache,
+		ctrl:        ctrl,
+	}
+}
+
+// createBanner creates banner bypassing HTTP API and returns its id.
+
+func (h *testHandler) createBanner(input models.CreateBannerInput) int {
+	out, err := h.ctrl.CreateBanner(context.Background(), &input)
+	require.NoError(h.t, err)
+	return out.BannerId
+}
+
+// roleToken returns token of given role with lifetime set for the manager.
+
+func (h *testHandler) roleToken(role string) string {
+	token, err := h.jwtManager.Generate(role)
+	require.NoError(h.t, err)
+	return token
+}
+
+// token returns token with given claims valid for an hour.
+
+func (h *testHandler) token(claims utils.UserClaims) string {
+	token, err := h.jwtManager.GenerateWithClaims(claims, time.Hour)
+	require.NoError(h.t, err)
+	return token
+}
+
+// subjectToken returns token of given subject and role valid for an hour.
+
+func (h *testHandler) subjectToken(subject, role string) string {
+	return h.token(utils.UserClaims{StandardClaims: jwt.StandardClaims{Subject: subject}, Role: role})
+}
+
+// newRequest returns request with JSON body authorized by token, if it's set.
+
+func (h *testHandler) newRequest(token, method, url, body string) *http.Request {
+	request := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return request
+}
+
+func (h *testHandler) serve(request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (h *testHandler) do(token, method, url, body string) *httptest.ResponseRecorder {
+	return h.serve(h.newRequest(token, method, url, body))
+}
+
+func TestGetUserBanners(t *testing.T) {
+	h := newTestHandler(t)
+	h.createBanner(models.CreateBannerInput{FeatureId: 1, TagIds: []int{1}, Content: `{"title":"first"}`, IsActive: true})
+	h.createBanner(models.CreateBannerInput{FeatureId: 2, TagIds: []int{1, 2}, Content: `{"title":"second"}`, IsActive: true})
+	h.createBanner(models.CreateBannerInput{FeatureId: 3, TagIds: []int{1}, Content: `{"title":"inactive"}`})
+	token := h.roleToken(rbac.RoleUser)
+
+	recorder := h.do(token, http.MethodPost, "/user_banners", `{"feature_ids":[1,2,3,4],"tag_id":1}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"1":{"title":"first"},"2":{"title":"second"}}`, recorder.Body.String())
+
+	tooMany := make([]string, models.MaxUserBannersFeatures+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+	for _, body := range []string{
+		`{"feature_ids":[],"tag_id":1}`,
+		`{"feature_ids":[1,1],"tag_id":1}`,
+		`{"feature_ids":[` + strings.Join(tooMany, ",") + `],"tag_id":1}`,
+		`{"feature_ids":"1"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, h.do(token, http.MethodPost, "/user_banners", body).Code, body)
+	}
+}
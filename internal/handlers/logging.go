@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/unbeman/av-banner-task/internal/logging"
+)
+
+// RequestIDHeader is a header with request id, incoming id is kept if it's valid and returned in response.
+const RequestIDHeader = "X-Request-ID"
+
+// requestID puts id of the request to context and response headers.
+func (h HttpHandler) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestID := logging.NormalizeRequestID(request.Header.Get(RequestIDHeader))
+		writer.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(writer, request.WithContext(logging.WithRequestID(request.Context(), requestID)))
+	})
+}
+
+// logging logs handled request with fields added by handlers, like actor and banner id.
+// Query is not logged, since it may contain tokens.
+func (h HttpHandler) logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		routeCtx := chi.RouteContext(request.Context())
+		ctx := logging.NewContext(request.Context(), log.Fields{
+			logging.FieldRoute: func() string {
+				if routeCtx == nil {
+					return ""
+				}
+				return routeCtx.RoutePattern()
+			},
+		})
+
+		start := time.Now()
+		wrapped := middleware.NewWrapResponseWriter(writer, request.ProtoMajor)
+		next.ServeHTTP(wrapped, request.WithContext(ctx))
+
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		remoteIP, _, err := net.SplitHostPort(request.RemoteAddr)
+		if err != nil {
+			remoteIP = request.RemoteAddr
+		}
+		entry := logging.FromContext(ctx).WithFields(log.Fields{
+			"method":      request.Method,
+			"path":        request.URL.Path,
+			"status":      status,
+			"bytes":       wrapped.BytesWritten(),
+			"duration_ms": time.Since(start).Milliseconds(),
+			"remote_ip":   remoteIP,
+		})
+		if status >= http.StatusInternalServerError {
+			entry.Error("request failed")
+			return
+		}
+		entry.Info("request handled")
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/logging"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+)
+
+func TestRequestLogging(t *testing.T) {
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	h := newTestHandler(t)
+	token := h.subjectToken("alice", rbac.RoleOwner)
+
+	do := func(requestId, method, url, body string) (*httptest.ResponseRecorder, *log.Entry) {
+		hook.Reset()
+		request := h.newRequest(token, method, url, body)
+		request.Header.Set(RequestIDHeader, requestId)
+		recorder := h.serve(request)
+		require.NotNil(t, hook.LastEntry())
+		return recorder, hook.LastEntry()
+	}
+
+	recorder, entry := do("req-1", http.MethodPost, "/banner?token=secret", `{"feature_id": 1, "tag_ids": [1], "content": "{}"}`)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "req-1", recorder.Header().Get(RequestIDHeader))
+	assert.Equal(t, "request handled", entry.Message)
+	assert.Equal(t, "req-1", entry.Data[logging.FieldRequestID])
+	assert.Equal(t, "/banner", entry.Data[logging.FieldRoute])
+	assert.Equal(t, "alice", entry.Data[logging.FieldActor])
+	// id созданного баннера добавлен контроллером
+	assert.Equal(t, 1, entry.Data[logging.FieldBannerID])
+	assert.Equal(t, http.StatusCreated, entry.Data["status"])
+	// query может содержать токены
+	assert.Equal(t, "/banner", entry.Data["path"])
+
+	recorder, entry = do("req-2", http.MethodDelete, "/banner/1", "")
+	require.Equal(t, http.StatusNoContent, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "/banner/{id}", entry.Data[logging.FieldRoute])
+	assert.Equal(t, 1, entry.Data[logging.FieldBannerID])
+
+	// небезопасный для лога id заменяется новым
+	recorder, entry = do("bad\nid", http.MethodGet, "/banner", "")
+	requestId := recorder.Header().Get(RequestIDHeader)
+	assert.NotEqual(t, "bad\nid", requestId)
+	assert.Len(t, requestId, 32)
+	assert.Equal(t, requestId, entry.Data[logging.FieldRequestID])
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "Duration of HTTP requests by method, route and status.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+// metrics observes duration of requests, route is a pattern to keep label values bounded.
+func (h HttpHandler) metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		wrapped := middleware.NewWrapResponseWriter(writer, request.ProtoMajor)
+		next.ServeHTTP(wrapped, request)
+
+		route := "unmatched"
+		if routeCtx := chi.RouteContext(request.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+			route = routeCtx.RoutePattern()
+		}
+		status := wrapped.Status()
+		if status == 0 { // обработчик ничего не записал
+			status = http.StatusOK
+		}
+		httpRequestDuration.WithLabelValues(request.Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+)
+
+func TestMetrics(t *testing.T) {
+	h := newTestHandler(t)
+	h.createBanner(models.CreateBannerInput{FeatureId: 100, TagIds: []int{100}, Content: `{}`, IsActive: true})
+
+	token := h.roleToken(rbac.RoleUser)
+	for _, url := range []string{"/user_banner?feature_id=100&tag_id=100", "/user_banner?feature_id=100&tag_id=100", "/banner/100"} {
+		h.do(token, http.MethodGet, url, "")
+	}
+
+	recorder := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+
+	// маршрут записывается шаблоном, а не путем запроса
+	assert.Contains(t, string(body), `http_request_duration_seconds_count{method="GET",route="/user_banner",status="200"}`)
+	assert.Contains(t, string(body), `http_request_duration_seconds_count{method="GET",route="/*",status="405"}`)
+	assert.Contains(t, string(body), `banner_cache_requests_total{result="hit"}`)
+	assert.Contains(t, string(body), `banner_cache_requests_total{result="miss"}`)
+}
@@ -8,21 +8,35 @@ import (
 	"strings"
 
 	"github.com/go-chi/render"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/unbeman/av-banner-task/internal/audit"
+	"github.com/unbeman/av-banner-task/internal/logging"
 	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/storage"
 	"github.com/unbeman/av-banner-task/internal/utils"
 )
 
-// Access levels for requests.
+// Legacy numeric roles of user_role claim.
 const (
-	ADMIN = iota
-	USER
+	legacyAdminRole = iota
+	legacyUserRole
 )
 
-var AccessContextKey = "access"
+var errTokenRevoked = errors.New("token is revoked")
 
-func (h HttpHandler) userAuthorization(next http.Handler) http.Handler {
+// APIKeyHeader is a header with API key of a service, it's used instead of user's token.
+const APIKeyHeader = "X-API-Key"
+
+// authorization verifies API key or token and puts its principal to request context.
+func (h HttpHandler) authorization(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if key := request.Header.Get(APIKeyHeader); key != "" {
+			h.apiKeyAuthorization(writer, request, next, key)
+			return
+		}
+
 		accessToken := getTokenFromRequest(request)
 		userClaims, err := h.jwtManager.Verify(accessToken)
 		if errors.Is(err, utils.ErrInvalidToken) {
@@ -34,35 +48,133 @@ func (h HttpHandler) userAuthorization(next http.Handler) http.Handler {
 			return
 		}
 
-		if userClaims.UserRole != ADMIN && userClaims.UserRole != USER {
-			render.Render(writer, request, models.ErrForbidden(fmt.Errorf("invalid user role")))
+		revoked, err := h.controller.IsTokenRevoked(request.Context(), userClaims.Id, userClaims.Expiration())
+		if err != nil {
+			render.Render(writer, request, models.ErrInternalServerError(err))
 			return
 		}
-		contextWithAccess := context.WithValue(request.Context(), AccessContextKey, userClaims.UserRole)
-		next.ServeHTTP(writer, request.WithContext(contextWithAccess))
-	})
-}
-
-func (h HttpHandler) adminAuthorization(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		accessToken := getTokenFromRequest(request)
-		userClaims, err := h.jwtManager.Verify(accessToken)
-		if errors.Is(err, utils.ErrInvalidToken) {
-			render.Render(writer, request, models.ErrUnauthorized(err))
+		if revoked {
+			render.Render(writer, request, models.ErrUnauthorized(errTokenRevoked))
 			return
 		}
+
+		principal, err := principalFromClaims(h.policy, userClaims)
 		if err != nil {
-			render.Render(writer, request, models.ErrInternalServerError(err))
+			render.Render(writer, request, models.ErrForbidden(err))
 			return
 		}
+		ctx := withActor(request.Context(), tokenActor(userClaims, principal))
+		next.ServeHTTP(writer, request.WithContext(rbac.WithPrincipal(ctx, principal)))
+	})
+}
 
-		if userClaims.UserRole != ADMIN {
-			render.Render(writer, request, models.ErrForbidden(fmt.Errorf("no access with given token")))
-			return
+// apiKeyAuthorization puts principal of active API key to request context.
+func (h HttpHandler) apiKeyAuthorization(writer http.ResponseWriter, request *http.Request, next http.Handler, key string) {
+	apiKey, err := h.controller.AuthenticateAPIKey(request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		render.Render(writer, request, models.ErrUnauthorized(fmt.Errorf("invalid API key")))
+		return
+	}
+	if err != nil {
+		render.Render(writer, request, models.ErrInternalServerError(err))
+		return
+	}
+
+	principal, err := principalFromAPIKey(h.policy, apiKey)
+	if err != nil {
+		render.Render(writer, request, models.ErrForbidden(err))
+		return
+	}
+	ctx := withActor(request.Context(), apiKeyActor(apiKey))
+	next.ServeHTTP(writer, request.WithContext(rbac.WithPrincipal(ctx, principal)))
+}
+
+func (h HttpHandler) permission(permission rbac.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if !h.checkPermission(writer, request, permission) {
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+func (h HttpHandler) checkPermission(writer http.ResponseWriter, request *http.Request, permission rbac.Permission) bool {
+	principal, _ := rbac.PrincipalFromContext(request.Context())
+	if err := h.policy.Check(principal, permission); err != nil {
+		render.Render(writer, request, models.ErrPermissionDenied(err, string(permission)))
+		return false
+	}
+	return true
+}
+
+// activeFilter returns filter of user banners: only active banners are visible without banner:read_inactive.
+func activeFilter(ctx context.Context, policy *rbac.Policy) *bool {
+	principal, _ := rbac.PrincipalFromContext(ctx)
+	if policy.Allowed(principal, rbac.ReadInactiveBanner) {
+		return nil
+	}
+	isActive := true
+	return &isActive
+}
+
+// principalFromClaims maps legacy user_role claim to owner and user roles.
+func principalFromClaims(policy *rbac.Policy, claims *utils.UserClaims) (*rbac.Principal, error) {
+	role := claims.Role
+	if role == "" && claims.UserRole != nil {
+		switch *claims.UserRole {
+		case legacyAdminRole:
+			role = rbac.RoleOwner
+		case legacyUserRole:
+			role = rbac.RoleUser
 		}
+	}
+	if !policy.HasRole(role) {
+		return nil, fmt.Errorf("invalid user role")
+	}
+	return &rbac.Principal{Role: role, Features: policy.FeatureScope(claims.Features, claims.Teams)}, nil
+}
 
-		next.ServeHTTP(writer, request)
-	})
+// principalFromAPIKey returns principal with role, scopes and features of API key.
+func principalFromAPIKey(policy *rbac.Policy, key *models.APIKey) (*rbac.Principal, error) {
+	// роль могла быть удалена из политики после создания ключа
+	if !policy.HasRole(key.Role) {
+		return nil, fmt.Errorf("invalid API key role")
+	}
+	principal := &rbac.Principal{Role: key.Role}
+	if key.FeatureIds != nil {
+		principal.Features = policy.FeatureScope(key.FeatureIds, nil)
+	}
+	if key.Scopes != nil {
+		principal.Scopes = make([]rbac.Permission, 0, len(key.Scopes))
+		for _, scope := range key.Scopes {
+			principal.Scopes = append(principal.Scopes, rbac.Permission(scope))
+		}
+	}
+	return principal, nil
+}
+
+// tokenActor returns identity of token owner for audit: subject, jti for tokens without subject or role for legacy tokens.
+func tokenActor(claims *utils.UserClaims, principal *rbac.Principal) string {
+	switch {
+	case claims.Subject != "":
+		return claims.Subject
+	case claims.Id != "":
+		return "jti:" + claims.Id
+	default:
+		return "role:" + principal.Role
+	}
+}
+
+func apiKeyActor(key *models.APIKey) string {
+	return fmt.Sprintf("api_key:%d", key.Id)
+}
+
+// withActor puts actor and request id to audit info and actor to log fields.
+func withActor(ctx context.Context, actor string) context.Context {
+	logging.AddFields(ctx, log.Fields{logging.FieldActor: actor})
+	return audit.WithInfo(ctx, audit.Info{Actor: actor, RequestId: logging.RequestID(ctx)})
 }
 
 func getTokenFromRequest(request *http.Request) string {
@@ -73,3 +185,29 @@ func getTokenFromRequest(request *http.Request) string {
 	}
 	return ""
 }
+
+// limitBody rejects requests with body larger than maxBodySize, the body is limited while reading too,
+// since its length may be unknown in advance.
+func (h HttpHandler) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.ContentLength > h.maxBodySize {
+			render.Render(writer, request, models.ErrRequestEntityTooLarge(errBodyTooLarge(h.maxBodySize)))
+			return
+		}
+		request.Body = http.MaxBytesReader(writer, request.Body, h.maxBodySize)
+		next.ServeHTTP(writer, request)
+	})
+}
+
+func errBodyTooLarge(limit int64) error {
+	return fmt.Errorf("request body is larger than %d bytes", limit)
+}
+
+// bindError returns response for error of request body decoding.
+func bindError(err error) *models.ErrResponse {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return models.ErrRequestEntityTooLarge(errBodyTooLarge(maxBytesErr.Limit))
+	}
+	return models.ErrBadRequest(err)
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+	"github.com/unbeman/av-banner-task/internal/utils"
+)
+
+func TestRoutePermissions(t *testing.T) {
+	h := newTestHandler(t)
+	require.Equal(t, 1, h.createBanner(models.CreateBannerInput{FeatureId: 1, TagIds: []int{1}, Content: `{}`}))
+
+	tests := []struct {
+		name               string
+		role               string
+		method             string
+		url                string
+		body               string
+		expectedStatus     int
+		expectedPermission string
+	}{
+		{
+			name: "user reads user banner", role: rbac.RoleUser,
+			method: http.MethodGet, url: "/user_banner?feature_id=1&tag_id=1",
+			// баннер выключен и не виден без banner:read_inactive
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "viewer reads inactive user banner", role: rbac.RoleViewer,
+			method: http.MethodGet, url: "/user_banner?feature_id=1&tag_id=1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "user lists banners", role: rbac.RoleUser,
+			method: http.MethodGet, url: "/banner",
+			expectedStatus: http.StatusForbidden, expectedPermission: "banner:list",
+		},
+		{
+			name: "viewer lists banners", role: rbac.RoleViewer,
+			method: http.MethodGet, url: "/banner",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "viewer creates banner", role: rbac.RoleViewer,
+			method: http.MethodPost, url: "/banner", body: `{"feature_id": 2, "tag_ids": [1], "content": "{}"}`,
+			expectedStatus: http.StatusForbidden, expectedPermission: "banner:create",
+		},
+		{
+			name: "editor creates inactive banner", role: rbac.RoleEditor,
+			method: http.MethodPost, url: "/banner", body: `{"feature_id": 2, "tag_ids": [1], "content": "{}"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "editor creates active banner", role: rbac.RoleEditor,
+			method: http.MethodPost, url: "/banner", body: `{"feature_id": 3, "tag_ids": [1], "content": "{}", "is_active": true}`,
+			expectedStatus: http.StatusForbidden, expectedPermission: "banner:publish",
+		},
+		{
+			name: "editor activates banner", role: rbac.RoleEditor,
+			method: http.MethodPatch, url: "/banner/1", body: `{"is_active": true}`,
+			expectedStatus: http.StatusForbidden, expectedPermission: "banner:publish",
+		},
+		{
+			name: "publisher activates banner", role: rbac.RolePublisher,
+			method: http.MethodPatch, url: "/banner/1", body: `{"is_active": true}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "publisher deletes banner", role: rbac.RolePublisher,
+			method: http.MethodDelete, url: "/banner/1",
+			expectedStatus: http.StatusForbidden, expectedPermission: "banner:delete",
+		},
+		{
+			name: "publisher gets webhooks", role: rbac.RolePublisher,
+			method: http.MethodGet, url: "/webhooks",
+			expectedStatus: http.StatusForbidden, expectedPermission: "webhook:manage",
+		},
+		{
+			name: "publisher warms up cache", role: rbac.RolePublisher,
+			method: http.MethodPost, url: "/cache/warmup",
+			expectedStatus: http.StatusForbidden, expectedPermission: "cache:warmup",
+		},
+		{
+			name: "owner deletes banner", role: rbac.RoleOwner,
+			method: http.MethodDelete, url: "/banner/1",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "unknown role", role: "admin",
+			method: http.MethodGet, url: "/user_banner?feature_id=1&tag_id=1",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := h.do(h.roleToken(test.role), test.method, test.url, test.body)
+			require.Equal(t, test.expectedStatus, recorder.Code, recorder.Body.String())
+			if test.expectedPermission != "" {
+				response := models.ErrResponse{}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, test.expectedPermission, response.Permission)
+				assert.Contains(t, response.ErrorText, test.expectedPermission)
+			}
+		})
+	}
+}
+
+func TestPrincipalFromLegacyClaims(t *testing.T) {
+	policy := rbac.DefaultPolicy()
+	role := func(value int) *int { return &value }
+
+	principal, err := principalFromClaims(policy, &utils.UserClaims{UserRole: role(legacyAdminRole)})
+	require.NoError(t, err)
+	assert.Equal(t, rbac.RoleOwner, principal.Role)
+
+	principal, err = principalFromClaims(policy, &utils.UserClaims{UserRole: role(legacyUserRole)})
+	require.NoError(t, err)
+	assert.Equal(t, rbac.RoleUser, principal.Role)
+
+	// новая роль важнее устаревшей
+	principal, err = principalFromClaims(policy, &utils.UserClaims{Role: rbac.RoleViewer, UserRole: role(legacyAdminRole)})
+	require.NoError(t, err)
+	assert.Equal(t, rbac.RoleViewer, principal.Role)
+
+	_, err = principalFromClaims(policy, &utils.UserClaims{UserRole: role(42)})
+	assert.Error(t, err)
+	_, err = principalFromClaims(policy, &utils.UserClaims{StandardClaims: jwt.StandardClaims{Subject: "no role"}})
+	assert.Error(t, err)
+}
+
+func TestFeatureScope(t *testing.T) {
+	policy := rbac.DefaultPolicy()
+	policy.SetTeamFeatures(map[string][]int{"promo": {1, 2}, "search": {3}})
+	h := newTestHandler(t, withPolicy(policy))
+
+	for featureId := 1; featureId <= 3; featureId++ {
+		h.createBanner(models.CreateBannerInput{FeatureId: featureId, TagIds: []int{1}, Content: `{}`})
+	}
+
+	do := func(claims utils.UserClaims, method, url, body string) *httptest.ResponseRecorder {
+		claims.Role = rbac.RoleOwner
+		return h.do(h.token(claims), method, url, body)
+	}
+	listedFeatures := func(recorder *httptest.ResponseRecorder) []int {
+		require.Equal(t, http.StatusOK, recorder.Code)
+		banners := models.Banners{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &banners))
+		featureIds := make([]int, 0, len(banners))
+		for _, banner := range banners {
+			featureIds = append(featureIds, banner.FeatureId)
+		}
+		return featureIds
+	}
+
+	promo := utils.UserClaims{Teams: []string{"promo"}}
+	feature3 := utils.UserClaims{Features: []int{3}}
+
+	assert.Equal(t, []int{1, 2, 3}, listedFeatures(do(utils.UserClaims{}, http.MethodGet, "/banner", "")))
+	assert.Equal(t, []int{1, 2}, listedFeatures(do(promo, http.MethodGet, "/banner", "")))
+	assert.Equal(t, []int{3}, listedFeatures(do(feature3, http.MethodGet, "/banner", "")))
+	assert.Empty(t, listedFeatures(do(promo, http.MethodGet, "/banner?feature_id=3", "")))
+	assert.Empty(t, listedFeatures(do(utils.UserClaims{Teams: []string{"unknown"}}, http.MethodGet, "/banner", "")))
+
+	assert.Equal(t, http.StatusForbidden, do(promo, http.MethodPost, "/banner", `{"feature_id": 3, "tag_ids": [2], "content": "{}"}`).Code)
+	assert.Equal(t, http.StatusCreated, do(feature3, http.MethodPost, "/banner", `{"feature_id": 3, "tag_ids": [2], "content": "{}"}`).Code)
+
+	// при переносе баннера проверяются и текущая, и новая фича
+	assert.Equal(t, http.StatusForbidden, do(promo, http.MethodPatch, "/banner/1", `{"feature_id": 3}`).Code)
+	assert.Equal(t, http.StatusForbidden, do(promo, http.MethodPatch, "/banner/3", `{"feature_id": 1}`).Code)
+	assert.Equal(t, http.StatusOK, do(promo, http.MethodPatch, "/banner/1", `{"feature_id": 2, "tag_ids": [2]}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(promo, http.MethodPatch, "/banner/100", `{"content": "{}"}`).Code)
+
+	assert.Equal(t, http.StatusForbidden, do(feature3, http.MethodDelete, "/banner/2", "").Code)
+	assert.Equal(t, http.StatusNoContent, do(promo, http.MethodDelete, "/banner/2", "").Code)
+}
+
+func TestAPIKeys(t *testing.T) {
+	h := newTestHandler(t)
+	for featureId := 1; featureId <= 2; featureId++ {
+		h.createBanner(models.CreateBannerInput{FeatureId: featureId, TagIds: []int{1}, Content: `{}`})
+	}
+
+	doWithToken := func(claims utils.UserClaims, method, url, body string) *httptest.ResponseRecorder {
+		return h.do(h.token(claims), method, url, body)
+	}
+	doWithKey := func(key, method, url, body string) *httptest.ResponseRecorder {
+		request := h.newRequest("", method, url, body)
+		request.Header.Set(APIKeyHeader, key)
+		return h.serve(request)
+	}
+	createKey := func(claims utils.UserClaims, body string) string {
+		recorder := doWithToken(claims, http.MethodPost, "/api_keys", body)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		out := models.CreateAPIKeyOutput{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &out))
+		return out.Key
+	}
+	owner := utils.UserClaims{Role: rbac.RoleOwner}
+
+	assert.Equal(t, http.StatusForbidden, doWithToken(utils.UserClaims{Role: rbac.RoleEditor}, http.MethodPost, "/api_keys", `{"role": "viewer"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doWithToken(owner, http.MethodPost, "/api_keys", `{"role": "admin"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doWithToken(owner, http.MethodPost, "/api_keys", `{"role": "editor", "scopes": ["banner:everything"]}`).Code)
+
+	// scopes сужают права роли ключа
+	key := createKey(owner, `{"role": "editor", "scopes": ["banner:list"], "description": "reporting"}`)
+	assert.Equal(t, http.StatusOK, doWithKey(key, http.MethodGet, "/banner", "").Code)
+	assert.Equal(t, http.StatusForbidden, doWithKey(key, http.MethodDelete, "/banner/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, doWithKey("bk_unknown", http.MethodGet, "/banner", "").Code)
+
+	// ключ с ограниченной областью может создать только владелец такой же или более широкой области
+	feature1 := utils.UserClaims{Role: rbac.RoleOwner, Features: []int{1}}
+	assert.Equal(t, http.StatusForbidden, doWithToken(feature1, http.MethodPost, "/api_keys", `{"role": "editor"}`).Code)
+	assert.Equal(t, http.StatusForbidden, doWithToken(feature1, http.MethodPost, "/api_keys", `{"role": "editor", "feature_ids": [2]}`).Code)
+	scopedKey := createKey(feature1, `{"role": "editor", "feature_ids": [1]}`)
+	assert.Equal(t, http.StatusOK, doWithKey(scopedKey, http.MethodPatch, "/banner/1", `{"content": "{}"}`).Code)
+	assert.Equal(t, http.StatusForbidden, doWithKey(scopedKey, http.MethodPatch, "/banner/2", `{"content": "{}"}`).Code)
+
+	recorder := doWithToken(owner, http.MethodGet, "/api_keys", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), key)
+	keys := models.APIKeys{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &keys))
+	require.Len(t, keys, 2)
+	assert.Equal(t, "reporting", keys[0].Description)
+	assert.True(t, strings.HasPrefix(key, keys[0].Prefix))
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	assert.Equal(t, http.StatusNoContent, doWithToken(owner, http.MethodDelete, "/api_keys/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, doWithToken(owner, http.MethodDelete, "/api_keys/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, doWithKey(key, http.MethodGet, "/banner", "").Code)
+}
+
+func TestAPIKeyDelegation(t *testing.T) {
+	policy, err := rbac.NewPolicy(map[string][]rbac.Permission{
+		rbac.RoleUser:   {rbac.ReadUserBanner},
+		rbac.RoleViewer: {rbac.ReadUserBanner, rbac.ListBanners},
+		rbac.RoleOwner:  rbac.Permissions,
+		"key_manager":   {rbac.ManageAPIKeys, rbac.ListBanners},
+	})
+	require.NoError(t, err)
+	h := newTestHandler(t, withPolicy(policy))
+
+	createKey := func(request *http.Request) (int, models.CreateAPIKeyOutput) {
+		recorder := h.serve(request)
+		out := models.CreateAPIKeyOutput{}
+		if recorder.Code == http.StatusCreated {
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &out))
+		}
+		return recorder.Code, out
+	}
+	withKey := func(key, method, url, body string) *http.Request {
+		request := h.newRequest("", method, url, body)
+		request.Header.Set(APIKeyHeader, key)
+		return request
+	}
+
+	// роль с правом управления ключами не выдает прав, которых у нее нет
+	manager := h.roleToken("key_manager")
+	code, _ := createKey(h.newRequest(manager, http.MethodPost, "/api_keys", `{"role": "owner"}`))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = createKey(h.newRequest(manager, http.MethodPost, "/api_keys", `{"role": "viewer"}`))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = createKey(h.newRequest(manager, http.MethodPost, "/api_keys", `{"role": "viewer", "scopes": ["banner:list"]}`))
+	assert.Equal(t, http.StatusCreated, code)
+
+	// ключ с scopes создает ключи только в пределах своих scopes
+	owner := h.roleToken(rbac.RoleOwner)
+	code, restricted := createKey(h.newRequest(owner, http.MethodPost, "/api_keys",
+		`{"role": "owner", "scopes": ["api_key:manage", "banner:list"], "feature_ids": [1]}`))
+	require.Equal(t, http.StatusCreated, code)
+	code, _ = createKey(withKey(restricted.Key, http.MethodPost, "/api_keys", `{"role": "owner", "feature_ids": [1]}`))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = createKey(withKey(restricted.Key, http.MethodPost, "/api_keys", `{"role": "owner", "scopes": ["banner:delete"], "feature_ids": [1]}`))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, created := createKey(withKey(restricted.Key, http.MethodPost, "/api_keys", `{"role": "viewer", "scopes": ["banner:list"], "feature_ids": [1]}`))
+	assert.Equal(t, http.StatusCreated, code)
+
+	// ключ с ограниченной областью фич видит и отзывает только ключи своей области
+	recorder := h.serve(withKey(restricted.Key, http.MethodGet, "/api_keys", ""))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	keys := models.APIKeys{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &keys))
+	keyIds := make([]int, 0, len(keys))
+	for _, key := range keys {
+		keyIds = append(keyIds, key.Id)
+	}
+	assert.Equal(t, []int{restricted.ApiKeyId, created.ApiKeyId}, keyIds)
+
+	assert.Equal(t, http.StatusNotFound, h.serve(withKey(restricted.Key, http.MethodDelete, "/api_keys/1", "")).Code)
+	assert.Equal(t, http.StatusNoContent, h.serve(withKey(restricted.Key, http.MethodDelete, "/api_keys/"+strconv.Itoa(created.ApiKeyId), "")).Code)
+}
+
+func TestRevokeToken(t *testing.T) {
+	h := newTestHandler(t)
+	generate := func(role string) (string, *utils.UserClaims) {
+		token := h.roleToken(role)
+		claims, err := h.jwtManager.Verify(token)
+		require.NoError(t, err)
+		return token, claims
+	}
+
+	owner, _ := generate(rbac.RoleOwner)
+	leaked, leakedClaims := generate(rbac.RoleOwner)
+	assert.Equal(t, http.StatusOK, h.do(leaked, http.MethodGet, "/banner", "").Code)
+
+	editor, _ := generate(rbac.RoleEditor)
+	assert.Equal(t, http.StatusForbidden, h.do(editor, http.MethodPost, "/tokens/revoke", `{"token": "`+leaked+`"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, h.do(owner, http.MethodPost, "/tokens/revoke", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, h.do(owner, http.MethodPost, "/tokens/revoke", `{"token": "invalid"}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, h.do(owner, http.MethodPost, "/tokens/revoke", `{"token": "`+leaked+`", "reason": "leaked"}`).Code)
+	recorder := h.do(leaked, http.MethodGet, "/banner", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "token is revoked")
+	assert.Equal(t, http.StatusOK, h.do(owner, http.MethodGet, "/banner", "").Code)
+
+	tokens, err := h.database.GetRevokedTokens(context.Background())
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, leakedClaims.Id, tokens[0].Jti)
+	assert.Equal(t, "leaked", tokens[0].Reason)
+	require.NotNil(t, tokens[0].ExpiresAt)
+
+	// отзыв по jti, при недоступном Redis проверка идет по базе
+	viewer, viewerClaims := generate(rbac.RoleViewer)
+	assert.Equal(t, http.StatusNoContent, h.do(owner, http.MethodPost, "/tokens/revoke", `{"jti": "`+viewerClaims.Id+`"}`).Code)
+	other := newTestHandler(t, withStorages(h.database, h.cache))
+	h.cache.mu.Lock()
+	h.cache.err = errors.New("redis is down")
+	h.cache.mu.Unlock()
+	assert.Equal(t, http.StatusUnauthorized, other.do(viewer, http.MethodGet, "/banner", "").Code)
+
+	// ошибка Redis после сохранения отзыва в базе не делает запрос неуспешным
+	_, publisherClaims := generate(rbac.RolePublisher)
+	assert.Equal(t, http.StatusNoContent, h.do(owner, http.MethodPost, "/tokens/revoke", `{"jti": "`+publisherClaims.Id+`"}`).Code)
+	revoked, err := h.database.IsTokenRevoked(context.Background(), publisherClaims.Id)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestIssueToken(t *testing.T) {
+	issue := func(h *testHandler, body string) *httptest.ResponseRecorder {
+		return h.do("", http.MethodPost, "/auth/token", body)
+	}
+
+	// по умолчанию выдача токенов выключена
+	disabled := newTestHandler(t)
+	assert.Equal(t, http.StatusUnauthorized, issue(disabled, `{"role": "owner"}`).Code)
+
+	handler := newTestHandler(t, withHandlerOptions(WithTokenIssuing(2*time.Hour, []string{rbac.RoleUser, rbac.RoleEditor})))
+	assert.Equal(t, http.StatusBadRequest, issue(handler, `{"role": "admin"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, issue(handler, `{"role": "editor", "ttl": "3h"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, issue(handler, `{"role": "editor", "ttl": "soon"}`).Code)
+	// роли вне AUTH_TOKEN_ROLES не выдаются
+	assert.Equal(t, http.StatusForbidden, issue(handler, `{"role": "owner"}`).Code)
+
+	recorder := issue(handler, `{"sub": "qa", "role": "editor", "features": [1, 2], "teams": ["promo"], "ttl": "90m"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	out := models.IssueTokenOutput{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &out))
+	assert.WithinDuration(t, time.Now().Add(90*time.Minute), out.ExpiresAt, 2*time.Second)
+
+	claims, err := handler.jwtManager.Verify(out.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "qa", claims.Subject)
+	assert.Equal(t, rbac.RoleEditor, claims.Role)
+	assert.Equal(t, []int{1, 2}, claims.Features)
+	assert.Equal(t, []string{"promo"}, claims.Teams)
+	assert.NotEmpty(t, claims.Id)
+}
+
+func TestLimitBody(t *testing.T) {
+	h := newTestHandler(t, withHandlerOptions(WithMaxBodySize(64)))
+	token := h.roleToken(rbac.RoleOwner)
+
+	send := func(method, url, body string, chunked bool) int {
+		request := h.newRequest(token, method, url, body)
+		if chunked { // длина тела неизвестна заранее
+			request.ContentLength = -1
+		}
+		return h.serve(request).Code
+	}
+
+	small := `{"feature_id": 1, "tag_ids": [1], "content": "{}"}`
+	large := `{"feature_id": 1, "tag_ids": [1], "content": "` + strings.Repeat("a", 64) + `"}`
+	assert.Equal(t, http.StatusCreated, send(http.MethodPost, "/banner", small, false))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(http.MethodPost, "/banner", large, false))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(http.MethodPost, "/banner", large, true))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(http.MethodPatch, "/banner/1", large, true))
+	assert.Equal(t, http.StatusOK, send(http.MethodPatch, "/banner/1", `{"content": "{}"}`, true))
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"github.com/unbeman/av-banner-task/internal/audit"
+	"github.com/unbeman/av-banner-task/internal/logging"
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+// Route groups with separate rate limits, RateLimitIP covers all requests before authorization.
+const (
+	RateLimitIP    = "ip"
+	RateLimitUser  = "user"
+	RateLimitAdmin = "admin"
+)
+
+const memoryBucketsCleanupInterval = time.Minute
+
+// RateLimit is a token bucket of Burst tokens refilled with Rate tokens per second, each request takes a token.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// RateLimiter takes a token from the bucket of given key, it returns false and time until the next token if the bucket is empty.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+}
+
+// rateLimit returns middleware limiting requests of each client identified by key to the route group.
+func (h HttpHandler) rateLimit(group string, key func(request *http.Request) string) func(http.Handler) http.Handler {
+	limit := h.rateLimits[group]
+	return func(next http.Handler) http.Handler {
+		if h.rateLimiter == nil || !limit.enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			allowed, retryAfter := allowRequest(request.Context(), h.rateLimiter, group, limit, key(request))
+			if !allowed {
+				writer.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+				render.Render(writer, request, models.ErrTooManyRequests(fmt.Errorf("rate limit exceeded")))
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// allowRequest takes a token from the bucket of the client in the route group.
+// Requests are allowed if limits storage is unavailable.
+func allowRequest(ctx context.Context, limiter RateLimiter, group string, limit RateLimit, key string) (bool, time.Duration) {
+	allowed, retryAfter, err := limiter.Allow(ctx, group+":"+key, limit.Rate, limit.Burst)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("couldn't check rate limit: %v", err)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+func retryAfterSeconds(retryAfter time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+}
+
+func rateLimitKey(request *http.Request) string {
+	return actorRateLimitKey(request.Context(), clientIPKey(request))
+}
+
+func actorRateLimitKey(ctx context.Context, ipKey string) string {
+	actor := audit.FromContext(ctx).Actor
+	if actor != "" && !strings.HasPrefix(actor, "role:") { // устаревшие токены одной роли неразличимы
+		return actor
+	}
+	return ipKey
+}
+
+func clientIPKey(request *http.Request) string {
+	return addrIPKey(request.RemoteAddr)
+}
+
+func addrIPKey(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return "ip:" + host
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	rate      float64
+	burst     int
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(float64(b.burst), b.tokens+now.Sub(b.updatedAt).Seconds()*b.rate)
+	b.updatedAt = now
+}
+
+// MemoryRateLimiter keeps token buckets in memory, limits are applied per service replica.
+type MemoryRateLimiter struct {
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+func (l *MemoryRateLimiter) Allow(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastCleanup) > memoryBucketsCleanupInterval {
+		l.cleanup(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), updatedAt: now}
+		l.buckets[key] = bucket
+	}
+	bucket.rate, bucket.burst = rate, burst
+	bucket.refill(now)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	retryAfter := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	return false, retryAfter, nil
+}
+
+func (l *MemoryRateLimiter) cleanup(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.refill(now); bucket.tokens >= float64(bucket.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastCleanup = now
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewMemoryRateLimiter()
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Allow(ctx, "client", 2, 3)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter, err := limiter.Allow(ctx, "client", 2, 3)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// у другого клиента своя корзина
+	allowed, _, err = limiter.Allow(ctx, "other", 2, 3)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _, err = limiter.Allow(ctx, "client", 2, 3)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// заполненные корзины удаляются
+	now = now.Add(2 * memoryBucketsCleanupInterval)
+	_, _, err = limiter.Allow(ctx, "client", 2, 3)
+	require.NoError(t, err)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	h := newTestHandler(t, withHandlerOptions(WithRateLimiter(NewMemoryRateLimiter(), map[string]RateLimit{
+		RateLimitIP:    {Rate: 0.5, Burst: 10},
+		RateLimitUser:  {Rate: 0.5, Burst: 2},
+		RateLimitAdmin: {Rate: 0.5, Burst: 1},
+	})))
+	h.createBanner(models.CreateBannerInput{FeatureId: 1, TagIds: []int{1}, Content: `{}`, IsActive: true})
+
+	alice, bob := h.subjectToken("alice", rbac.RoleOwner), h.subjectToken("bob", rbac.RoleOwner)
+	do := func(token, url string) *httptest.ResponseRecorder {
+		return h.do(token, http.MethodGet, url, "")
+	}
+
+	assert.Equal(t, http.StatusOK, do(alice, "/user_banner?feature_id=1&tag_id=1").Code)
+	assert.Equal(t, http.StatusOK, do(alice, "/user_banner?feature_id=1&tag_id=1").Code)
+	recorder := do(alice, "/user_banner?feature_id=1&tag_id=1")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+
+	// лимиты считаются отдельно для клиентов и групп маршрутов
+	assert.Equal(t, http.StatusOK, do(bob, "/user_banner?feature_id=1&tag_id=1").Code)
+	assert.Equal(t, http.StatusOK, do(alice, "/banner").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(alice, "/banner").Code)
+
+	// перебор токенов с одного адреса ограничивается до проверки токена, 6 из 10 запросов адреса уже сделаны выше
+	codes := make(map[int]int)
+	for i := 0; i < 5; i++ {
+		codes[do("invalid-token", "/user_banner?feature_id=1&tag_id=1").Code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusUnauthorized: 4, http.StatusTooManyRequests: 1}, codes)
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	// RATE_LIMIT_IP по умолчанию не задан, все запросы приходят с адреса прокси
+	h := newTestHandler(t, withHandlerOptions(WithRateLimiter(NewMemoryRateLimiter(), map[string]RateLimit{
+		RateLimitIP:    {},
+		RateLimitUser:  {Rate: 0.5, Burst: 1},
+		RateLimitAdmin: {Rate: 0.5, Burst: 1},
+	})))
+	h.createBanner(models.CreateBannerInput{FeatureId: 1, TagIds: []int{1}, Content: `{}`, IsActive: true})
+
+	for i := 0; i < 20; i++ {
+		token := h.subjectToken(fmt.Sprintf("user-%d", i), rbac.RoleOwner)
+		recorder := h.do(token, http.MethodGet, "/user_banner?feature_id=1&tag_id=1", "")
+		assert.Equal(t, http.StatusOK, recorder.Code, "client %d is limited by proxy address", i)
+	}
+}
@@ -0,0 +1,520 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/unbeman/av-banner-task/internal/audit"
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+// fakeDatabase is an in-memory storage.Database for tests without PostgreSQL.
+type fakeDatabase struct {
+	mu      sync.Mutex
+	banners map[int]*models.Banner
+	lastId  int
+	changes []*models.BannerChange
+	apiKeys models.APIKeys
+	revoked map[string]*models.RevokedToken
+	audit   models.AuditRecords
+	err     error // если задана, то возвращается получением баннера, как при недоступном PostgreSQL
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{banners: make(map[int]*models.Banner), revoked: make(map[string]*models.RevokedToken)}
+}
+
+// setErr makes getting banners fail with given error, nil restores it.
+func (d *fakeDatabase) setErr(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+}
+
+func (d *fakeDatabase) find(featureId, tagId int, isActive *bool) *models.Banner {
+	for _, banner := range d.banners {
+		if banner.FeatureId != featureId || !slices.Contains(banner.TagIds, tagId) {
+			continue
+		}
+		if isActive != nil && banner.IsActive != *isActive {
+			continue
+		}
+		return banner
+	}
+	return nil
+}
+
+func (d *fakeDatabase) GetBanner(ctx context.Context, featureId int, tagId int, isActive *bool) (*models.Banner, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	banner := d.find(featureId, tagId, isActive)
+	if banner == nil {
+		return nil, fmt.Errorf("banner with given feature_id (%d) and tag_id (%d): %w", featureId, tagId, storage.ErrNotFound)
+	}
+	copied := *banner
+	return &copied, nil
+}
+
+func (d *fakeDatabase) GetBannerById(ctx context.Context, bannerId int) (*models.Banner, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	banner, ok := d.banners[bannerId]
+	if !ok {
+		return nil, fmt.Errorf("banner with given id (%d): %w", bannerId, storage.ErrNotFound)
+	}
+	copied := *banner
+	return &copied, nil
+}
+
+func (d *fakeDatabase) GetBannersByFeatures(ctx context.Context, featureIds []int, tagId int, isActive *bool) (map[int]*models.Banner, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	banners := make(map[int]*models.Banner)
+	for _, featureId := range featureIds {
+		if banner := d.find(featureId, tagId, isActive); banner != nil {
+			copied := *banner
+			banners[featureId] = &copied
+		}
+	}
+	return banners, nil
+}
+
+func (d *fakeDatabase) StreamActiveBanners(ctx context.Context, limit int, fn func(banner storage.CachedBanner) error) error {
+	d.mu.Lock()
+	var banners []storage.CachedBanner
+	for _, banner := range d.banners {
+		if !banner.IsActive {
+			continue
+		}
+		for _, tagId := range banner.TagIds {
+			banners = append(banners, storage.CachedBanner{FeatureId: banner.FeatureId, TagId: tagId, Content: banner.Content})
+		}
+	}
+	d.mu.Unlock()
+
+	if limit > 0 && len(banners) > limit {
+		banners = banners[:limit]
+	}
+	for _, banner := range banners {
+		if err := fn(banner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fakeDatabase) GetBanners(ctx context.Context, featureId *int, tagId *int, featureIds []int, limit *int, offset *int) (*models.Banners, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	banners := models.Banners{}
+	for id := 1; id <= d.lastId; id++ {
+		banner, ok := d.banners[id]
+		if !ok {
+			continue
+		}
+		if featureId != nil && banner.FeatureId != *featureId {
+			continue
+		}
+		if tagId != nil && !slices.Contains(banner.TagIds, *tagId) {
+			continue
+		}
+		if featureIds != nil && !slices.Contains(featureIds, banner.FeatureId) {
+			continue
+		}
+		copied := *banner
+		banners = append(banners, &copied)
+	}
+	return &banners, nil
+}
+
+func (d *fakeDatabase) CreateBanner(ctx context.Context, banner *models.Banner) (*models.Banner, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, tagId := range banner.TagIds {
+		if d.find(banner.FeatureId, tagId, nil) != nil {
+			return nil, fmt.Errorf("given feature or tag: %w", storage.ErrConflict)
+		}
+	}
+	d.lastId++
+	banner.Id = d.lastId
+	copied := *banner
+	d.banners[banner.Id] = &copied
+	d.writeAudit(ctx, models.AuditCreate, banner.Id, nil, &copied)
+	d.writeChange(models.BannerCreated, &copied)
+	return banner, nil
+}
+
+func (d *fakeDatabase) UpdateBanner(ctx context.Context, input *models.UpdateBannerInput) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	banner, ok := d.banners[input.Id]
+	if !ok {
+		return fmt.Errorf("banner with given id (%d): %w", input.Id, storage.ErrNotFound)
+	}
+	before := *banner
+	defer d.writeAudit(ctx, models.AuditUpdate, banner.Id, &before, banner)
+	defer d.writeChange(models.BannerUpdated, banner)
+	if input.FeatureId != nil {
+		banner.FeatureId = *input.FeatureId
+	}
+	if input.TagIds != nil {
+		banner.TagIds = *input.TagIds
+	}
+	if input.Content != nil {
+		banner.Content = *input.Content
+	}
+	if input.IsActive != nil {
+		banner.IsActive = *input.IsActive
+	}
+	return nil
+}
+
+func (d *fakeDatabase) DeleteBanner(ctx context.Context, bannerId int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	banner, ok := d.banners[bannerId]
+	if !ok {
+		return fmt.Errorf("banner with given id (%d): %w", bannerId, storage.ErrNotFound)
+	}
+	delete(d.banners, bannerId)
+	d.writeAudit(ctx, models.AuditDelete, bannerId, banner, nil)
+	d.writeChange(models.BannerDeleted, banner)
+	return nil
+}
+
+// writeChange records banner change like PostgreSQL storage does within the write, d.mu should be held.
+func (d *fakeDatabase) writeChange(event string, banner *models.Banner) {
+	id := len(d.changes) + 1
+	d.changes = append(d.changes, &models.BannerChange{
+		Id:        id,
+		TxId:      int64(id),
+		Event:     event,
+		BannerId:  banner.Id,
+		FeatureId: banner.FeatureId,
+		TagIds:    slices.Clone(banner.TagIds),
+		CreatedAt: time.Now(),
+	})
+}
+
+func (d *fakeDatabase) GetBannerChanges(ctx context.Context, after models.BannerChangeCursor, featureIds []int, limit int) ([]*models.BannerChange, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changes := make([]*models.BannerChange, 0, limit)
+	for _, change := range d.changes[min(after.Id, len(d.changes)):] {
+		if featureIds != nil && !slices.Contains(featureIds, change.FeatureId) {
+			continue
+		}
+		if len(changes) < limit {
+			copied := *change
+			changes = append(changes, &copied)
+		}
+	}
+	return changes, nil
+}
+
+func (d *fakeDatabase) GetLastBannerChangeCursor(ctx context.Context) (models.BannerChangeCursor, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.changes) == 0 {
+		return models.BannerChangeCursor{}, nil
+	}
+	return d.changes[len(d.changes)-1].Cursor(), nil
+}
+
+// Webhooks are not used by handler tests.
+func (d *fakeDatabase) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (d *fakeDatabase) GetWebhooks(ctx context.Context) (models.Webhooks, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (d *fakeDatabase) DeleteWebhook(ctx context.Context, webhookId int) error {
+	return errors.ErrUnsupported
+}
+
+func (d *fakeDatabase) GetWebhookDeliveries(ctx context.Context, webhookId int, status *string, limit *int, offset *int) (models.WebhookDeliveries, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (d *fakeDatabase) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key.Id = len(d.apiKeys) + 1
+	key.CreatedAt = time.Now()
+	copied := *key
+	d.apiKeys = append(d.apiKeys, &copied)
+	return key, nil
+}
+
+// keyInScope reports whether key is limited to features from featureIds, nil featureIds allow any key.
+func keyInScope(key *models.APIKey, featureIds []int) bool {
+	if featureIds == nil {
+		return true
+	}
+	if key.FeatureIds == nil {
+		return false
+	}
+	for _, featureId := range key.FeatureIds {
+		if !slices.Contains(featureIds, featureId) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *fakeDatabase) GetAPIKeys(ctx context.Context, featureIds []int) (models.APIKeys, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	keys := models.APIKeys{}
+	for _, key := range d.apiKeys {
+		if !keyInScope(key, featureIds) {
+			continue
+		}
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
+
+func (d *fakeDatabase) GetActiveAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, key := range d.apiKeys {
+		if key.Hash == hash && key.RevokedAt == nil {
+			copied := *key
+			now := time.Now()
+			key.LastUsedAt = &now
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("API key: %w", storage.ErrNotFound)
+}
+
+func (d *fakeDatabase) RevokeAPIKey(ctx context.Context, keyId int, featureIds []int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, key := range d.apiKeys {
+		if key.Id == keyId && key.RevokedAt == nil && keyInScope(key, featureIds) {
+			now := time.Now()
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("active API key with given id (%d): %w", keyId, storage.ErrNotFound)
+}
+
+func (d *fakeDatabase) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.revoked[token.Jti]; !ok {
+		copied := *token
+		copied.RevokedAt = time.Now()
+		d.revoked[token.Jti] = &copied
+	}
+	return nil
+}
+
+func (d *fakeDatabase) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.revoked[jti]
+	return ok, nil
+}
+
+func (d *fakeDatabase) GetRevokedTokens(ctx context.Context) ([]*models.RevokedToken, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tokens := []*models.RevokedToken{}
+	for _, token := range d.revoked {
+		if token.ExpiresAt == nil || token.ExpiresAt.After(time.Now()) {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+	return tokens, nil
+}
+
+func (d *fakeDatabase) writeAudit(ctx context.Context, action string, bannerId int, before, after *models.Banner) {
+	info := audit.FromContext(ctx)
+	d.audit = append(d.audit, &models.AuditRecord{
+		Id:        len(d.audit) + 1,
+		Action:    action,
+		BannerId:  bannerId,
+		Actor:     info.Actor,
+		RequestId: info.RequestId,
+		Changes:   models.BannerDiff(before, after),
+		CreatedAt: time.Now(),
+	})
+}
+
+func (d *fakeDatabase) GetAuditRecords(ctx context.Context, filter *models.GetAuditInput) (models.AuditRecords, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	records := models.AuditRecords{}
+	for i := len(d.audit) - 1; i >= 0; i-- {
+		record := d.audit[i]
+		if filter.BannerId != nil && record.BannerId != *filter.BannerId ||
+			filter.Actor != nil && record.Actor != *filter.Actor ||
+			filter.From != nil && record.CreatedAt.Before(*filter.From) ||
+			filter.To != nil && !record.CreatedAt.Before(*filter.To) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// fakeCache is an in-memory storage.Cache for tests without Redis.
+type fakeCache struct {
+	mu      sync.Mutex
+	banners map[string]string
+	stale   map[string]string
+	revoked map[string]struct{}
+	err     error // если задана, то возвращается всеми методами, как при недоступном Redis
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{banners: make(map[string]string), stale: make(map[string]string), revoked: make(map[string]struct{})}
+}
+
+func fakeCacheKey(featureId, tagId int) string {
+	return fmt.Sprintf("%d-%d", featureId, tagId)
+}
+
+func (c *fakeCache) GetBanner(ctx context.Context, featureId, tagId int) (*string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	content, ok := c.banners[fakeCacheKey(featureId, tagId)]
+	if !ok {
+		return nil, fmt.Errorf("no banner: %w", storage.ErrNotFound)
+	}
+	return &content, nil
+}
+
+func (c *fakeCache) SetBanner(ctx context.Context, featureId, tagId int, bannerContent *string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.banners[fakeCacheKey(featureId, tagId)] = *bannerContent
+	c.stale[fakeCacheKey(featureId, tagId)] = *bannerContent
+	return nil
+}
+
+func (c *fakeCache) DeleteBanners(ctx context.Context, featureId int, tagIds []int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	for _, tagId := range tagIds {
+		delete(c.banners, fakeCacheKey(featureId, tagId))
+		delete(c.stale, fakeCacheKey(featureId, tagId))
+	}
+	return nil
+}
+
+func (c *fakeCache) GetStaleBanner(ctx context.Context, featureId, tagId int) (*string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	content, ok := c.stale[fakeCacheKey(featureId, tagId)]
+	if !ok {
+		return nil, fmt.Errorf("no banner: %w", storage.ErrNotFound)
+	}
+	return &content, nil
+}
+
+// expire removes fresh cached banners, like after expiration in Redis, last known good copies are kept.
+func (c *fakeCache) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.banners)
+}
+
+func (c *fakeCache) cached(featureId, tagId int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.banners[fakeCacheKey(featureId, tagId)]
+	return ok
+}
+
+func (c *fakeCache) GetBannersByFeatures(ctx context.Context, featureIds []int, tagId int) (map[int]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	bannersContent := make(map[int]string)
+	for _, featureId := range featureIds {
+		if content, ok := c.banners[fakeCacheKey(featureId, tagId)]; ok {
+			bannersContent[featureId] = content
+		}
+	}
+	return bannersContent, nil
+}
+
+func (c *fakeCache) SetBannersByFeatures(ctx context.Context, tagId int, bannersContent map[int]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	for featureId, content := range bannersContent {
+		c.banners[fakeCacheKey(featureId, tagId)] = content
+		c.stale[fakeCacheKey(featureId, tagId)] = content
+	}
+	return nil
+}
+
+func (c *fakeCache) SetBanners(ctx context.Context, banners []storage.CachedBanner) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	for _, banner := range banners {
+		c.banners[fakeCacheKey(banner.FeatureId, banner.TagId)] = banner.Content
+		c.stale[fakeCacheKey(banner.FeatureId, banner.TagId)] = banner.Content
+	}
+	return nil
+}
+
+func (c *fakeCache) SetRevokedToken(ctx context.Context, jti string, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.revoked[jti] = struct{}{}
+	return nil
+}
+
+func (c *fakeCache) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false, c.err
+	}
+	_, ok := c.revoked[jti]
+	return ok, nil
+}
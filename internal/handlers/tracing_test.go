@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/rbac"
+)
+
+func TestTracing(t *testing.T) {
+	h := newTestHandler(t)
+	h.createBanner(models.CreateBannerInput{FeatureId: 100, TagIds: []int{100}, Content: `{}`, IsActive: true})
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	request := h.newRequest(h.roleToken(rbac.RoleUser), http.MethodGet, "/user_banner?feature_id=100&tag_id=100", "")
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.serve(request)
+
+	spans := recorder.Ended()
+	require.NotEmpty(t, spans)
+	var server, getBanner sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		// все спаны запроса продолжают входящую трассировку
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		switch span.Name() {
+		case "GET /user_banner":
+			server = span
+		case "Controller.GetBanner":
+			getBanner = span
+		}
+	}
+	require.NotNil(t, server)
+	require.NotNil(t, getBanner)
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, server.SpanContext().SpanID(), getBanner.Parent().SpanID())
+}
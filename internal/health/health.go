@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+var errShuttingDown = errors.New("service is shutting down")
+
+// Check returns error if dependency isn't available.
+type Check func(ctx context.Context) error
+
+// CheckResult is a status of one dependency.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is a response of readiness probe.
+type Report struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	check    Check
+	critical bool
+}
+
+// Checker checks service dependencies for readiness probe.
+// Each check is limited by timeout, so a hanging dependency doesn't hang the probe.
+type Checker struct {
+	checks       map[string]namedCheck
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		checks:  map[string]namedCheck{},
+		timeout: timeout,
+	}
+}
+
+// Add registers check of dependency required to serve requests, it must be called before serving probes.
+func (c *Checker) Add(name string, check Check) {
+	c.checks[name] = namedCheck{check: check, critical: true}
+}
+
+// AddNonCritical registers check of dependency the service can work without,
+// its failure is reported but doesn't fail readiness.
+func (c *Checker) AddNonCritical(name string, check Check) {
+	c.checks[name] = namedCheck{check: check}
+}
+
+// SetShuttingDown makes readiness probe fail, so balancer stops sending new requests to the replica.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs all checks concurrently and returns their statuses.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusFail, Error: errShuttingDown.Error()}
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check namedCheck) {
+			defer wg.Done()
+			result := c.runCheck(ctx, check.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK && check.critical {
+				report.Status = StatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) runCheck(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	// проверка может не учитывать контекст, поэтому таймаут отслеживается отдельно
+	go func() { errCh <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := CheckResult{Status: StatusOK, Duration: time.Since(start).Round(time.Millisecond).String()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Liveness responds OK while the process is able to serve requests.
+func (c *Checker) Liveness(writer http.ResponseWriter, request *http.Request) {
+	render.JSON(writer, request, Report{Status: StatusOK})
+}
+
+// Readiness responds OK if all dependencies are available, 503 with statuses of dependencies otherwise.
+func (c *Checker) Readiness(writer http.ResponseWriter, request *http.Request) {
+	report := c.Check(request.Context())
+	if report.Status != StatusOK {
+		render.Status(request, http.StatusServiceUnavailable)
+	}
+	render.JSON(writer, request, report)
+}
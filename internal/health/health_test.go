@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readiness(t *testing.T, checker *Checker) (int, Report) {
+	recorder := httptest.NewRecorder()
+	checker.Readiness(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	report := Report{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&report))
+	return recorder.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("postgres", func(ctx context.Context) error { return nil })
+	// без кэша сервис продолжает работать
+	checker.AddNonCritical("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	code, report := readiness(t, checker)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+	assert.Equal(t, StatusFail, report.Checks["redis"].Status)
+	assert.Equal(t, "connection refused", report.Checks["redis"].Error)
+
+	// зависшая проверка, не учитывающая контекст, прерывается по таймауту
+	checker.Add("migrations", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	start := time.Now()
+	code, report = readiness(t, checker)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["migrations"].Error)
+}
+
+func TestReadinessShuttingDown(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("postgres", func(ctx context.Context) error { return nil })
+	checker.SetShuttingDown()
+
+	code, report := readiness(t, checker)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, errShuttingDown.Error(), report.Error)
+
+	// процесс жив до завершения
+	recorder := httptest.NewRecorder()
+	checker.Liveness(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats of log output.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Names of fields correlating log lines of a request.
+const (
+	FieldRequestID = "request_id"
+	FieldRoute     = "route" // шаблон маршрута HTTP или полное имя метода gRPC
+	FieldActor     = "actor" // субъект токена или API-ключ, как в аудите
+	FieldBannerID  = "banner_id"
+	FieldFeatureID = "feature_id"
+	FieldTagID     = "tag_id"
+	FieldTraceID   = "trace_id"
+)
+
+// maxRequestIDLength limits length of incoming request id.
+const maxRequestIDLength = 128
+
+// Setup sets level and format of the standard logger.
+func Setup(level, format string) error {
+	logLevel, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(logLevel)
+
+	switch format {
+	case FormatText, "":
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	case FormatJSON:
+		log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+type fieldsKey struct{}
+
+// fields are shared by all contexts derived from the one they were added to.
+type fields struct {
+	mu     sync.Mutex
+	values log.Fields
+}
+
+// NewContext returns context with own log fields, they include fields of ctx and given ones.
+// Fields added later with AddFields are visible through every context derived from the returned one,
+// so middlewares which started a request log fields added by handlers.
+func NewContext(ctx context.Context, values log.Fields) context.Context {
+	f := &fields{values: log.Fields{}}
+	if parent, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.values = parent.snapshot()
+	}
+	maps.Copy(f.values, values)
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// AddFields adds fields to log fields of ctx, it does nothing if ctx was not created with NewContext.
+func AddFields(ctx context.Context, values log.Fields) {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	maps.Copy(f.values, values)
+}
+
+func (f *fields) snapshot() log.Fields {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := make(log.Fields, len(f.values))
+	for key, value := range f.values {
+		// значение может быть известно только к моменту записи, например шаблон маршрута после роутинга
+		if lazy, ok := value.(func() string); ok {
+			value = lazy()
+			if value == "" {
+				continue
+			}
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// FromContext returns logger with fields of ctx and trace id of its span.
+// Values of type func() string are evaluated when the line is logged and skipped if empty.
+func FromContext(ctx context.Context) *log.Entry {
+	entry := log.WithContext(ctx)
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		entry = entry.WithFields(f.snapshot())
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		entry = entry.WithField(FieldTraceID, spanContext.TraceID().String())
+	}
+	return entry
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns context with request id, which is added to log fields too.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return NewContext(context.WithValue(ctx, requestIDKey{}, requestID), log.Fields{FieldRequestID: requestID})
+}
+
+// RequestID returns request id of ctx, empty if there is none.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// NormalizeRequestID returns incoming request id if it's safe to log, otherwise a new random one.
+func NormalizeRequestID(incoming string) string {
+	if validRequestID(incoming) {
+		return incoming
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// validRequestID allows only characters which can't break log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
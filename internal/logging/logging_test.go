@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextFields(t *testing.T) {
+	route := ""
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = NewContext(ctx, log.Fields{FieldRoute: func() string { return route }})
+	assert.Equal(t, "req-1", RequestID(ctx))
+	assert.Equal(t, log.Fields{FieldRequestID: "req-1"}, FromContext(ctx).Data, "empty lazy value is skipped")
+
+	// поля, добавленные в производном контексте, видны в исходном
+	derived, cancel := context.WithCancel(ctx)
+	defer cancel()
+	AddFields(derived, log.Fields{FieldBannerID: 1})
+	route = "/banner/{id}"
+	assert.Equal(t, log.Fields{FieldRequestID: "req-1", FieldRoute: "/banner/{id}", FieldBannerID: 1}, FromContext(ctx).Data)
+
+	// у нового контекста свои поля
+	task := NewContext(ctx, log.Fields{"task": "revalidation"})
+	AddFields(task, log.Fields{FieldBannerID: 2})
+	assert.Equal(t, 2, FromContext(task).Data[FieldBannerID])
+	assert.Equal(t, 1, FromContext(ctx).Data[FieldBannerID])
+
+	AddFields(context.Background(), log.Fields{FieldBannerID: 3})
+	assert.Empty(t, FromContext(context.Background()).Data)
+}
+
+func TestNormalizeRequestID(t *testing.T) {
+	assert.Equal(t, "req-1.a_b:c", NormalizeRequestID("req-1.a_b:c"))
+	for _, incoming := range []string{"", "bad id", "bad\nid", `{"json"}`, strings.Repeat("a", maxRequestIDLength+1)} {
+		generated := NormalizeRequestID(incoming)
+		assert.Len(t, generated, 32, incoming)
+		assert.True(t, validRequestID(generated))
+	}
+	assert.NotEqual(t, NormalizeRequestID(""), NormalizeRequestID(""))
+}
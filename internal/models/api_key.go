@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// APIKey gives service access with given role, only hash of the key is stored.
+type APIKey struct {
+	Id          int      `json:"api_key_id"`
+	Prefix      string   `json:"prefix"` // начало ключа для его опознания
+	Hash        string   `json:"-"`
+	Role        string   `json:"role"`
+	Scopes      []string `json:"scopes"`      // если заданы, то из прав роли доступны только они
+	FeatureIds  []int    `json:"feature_ids"` // если заданы, то ключ управляет баннерами только этих фич
+	Description string   `json:"description"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type APIKeys []*APIKey
+
+type CreateAPIKeyInput struct {
+	Role        string   `json:"role"`
+	Scopes      []string `json:"scopes"`
+	FeatureIds  []int    `json:"feature_ids"`
+	Description string   `json:"description"`
+}
+
+func (i *CreateAPIKeyInput) Bind(r *http.Request) error {
+	return i.Validate()
+}
+
+func (i *CreateAPIKeyInput) Validate() error {
+	if i.Role == "" {
+		return fmt.Errorf("role is empty")
+	}
+	return nil
+}
+
+type CreateAPIKeyOutput struct {
+	ApiKeyId int    `json:"api_key_id"`
+	Key      string `json:"key"` // возвращается только при создании
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Audit actions with banners.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRecord is an append-only record of a banner change made by an admin.
+type AuditRecord struct {
+	Id        int                    `json:"audit_id"`
+	Action    string                 `json:"action"`
+	BannerId  int                    `json:"banner_id"`
+	Actor     string                 `json:"actor"`
+	RequestId string                 `json:"request_id"`
+	Changes   map[string]FieldChange `json:"changes"` // измененные поля баннера
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type AuditRecords []*AuditRecord
+
+// FieldChange is a value of banner field before and after the change, nil for absent banner.
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// BannerDiff returns changed fields of banner, before is nil for created banner and after is nil for deleted one.
+func BannerDiff(before, after *Banner) map[string]FieldChange {
+	fields := func(banner *Banner) map[string]any {
+		if banner == nil {
+			return map[string]any{}
+		}
+		tagIds := slices.Clone(banner.TagIds)
+		slices.Sort(tagIds)
+		return map[string]any{
+			"feature_id": banner.FeatureId,
+			"tag_ids":    tagIds,
+			"content":    banner.Content,
+			"is_active":  banner.IsActive,
+		}
+	}
+	beforeFields, afterFields := fields(before), fields(after)
+
+	changes := make(map[string]FieldChange)
+	for _, name := range []string{"feature_id", "tag_ids", "content", "is_active"} {
+		beforeValue, afterValue := beforeFields[name], afterFields[name]
+		if before != nil && after != nil && fmt.Sprint(beforeValue) == fmt.Sprint(afterValue) {
+			continue
+		}
+		changes[name] = FieldChange{Before: beforeValue, After: afterValue}
+	}
+	return changes
+}
+
+type GetAuditInput struct {
+	BannerId *int
+	Actor    *string
+	From     *time.Time
+	To       *time.Time
+	Limit    *int
+	Offset   *int
+}
+
+func (i *GetAuditInput) FromURI(r *http.Request) error {
+	bannerParam := r.URL.Query().Get("banner_id")
+	if bannerParam != "" {
+		bannerId, err := strconv.Atoi(bannerParam)
+		if err != nil {
+			return err
+		}
+		i.BannerId = &bannerId
+	}
+
+	actorParam := r.URL.Query().Get("actor")
+	if actorParam != "" {
+		i.Actor = &actorParam
+	}
+
+	fromParam := r.URL.Query().Get("from")
+	if fromParam != "" {
+		from, err := time.Parse(time.RFC3339, fromParam)
+		if err != nil {
+			return err
+		}
+		i.From = &from
+	}
+
+	toParam := r.URL.Query().Get("to")
+	if toParam != "" {
+		to, err := time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			return err
+		}
+		i.To = &to
+	}
+
+	limitParam := r.URL.Query().Get("limit")
+	if limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil {
+			return err
+		}
+		i.Limit = &limit
+	}
+
+	offsetParam := r.URL.Query().Get("offset")
+	if offsetParam != "" {
+		offset, err := strconv.Atoi(offsetParam)
+		if err != nil {
+			return err
+		}
+		i.Offset = &offset
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// IssueTokenInput describes claims of a token issued for development and testing.
+type IssueTokenInput struct {
+	Subject  string   `json:"sub"`
+	Role     string   `json:"role"`
+	Features []int    `json:"features"` // без features и teams токен не ограничен фичами
+	Teams    []string `json:"teams"`
+	TTL      string   `json:"ttl"` // время жизни, например 30m или 24h
+
+	Lifetime time.Duration `json:"-"` // разобранный TTL, 0 - время жизни по умолчанию
+}
+
+func (i *IssueTokenInput) Bind(r *http.Request) error {
+	return i.Validate()
+}
+
+func (i *IssueTokenInput) Validate() error {
+	if i.Role == "" {
+		return fmt.Errorf("role is empty")
+	}
+	if i.TTL != "" {
+		ttl, err := time.ParseDuration(i.TTL)
+		if err != nil {
+			return fmt.Errorf("invalid ttl: %w", err)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("ttl should be positive")
+		}
+		i.Lifetime = ttl
+	}
+	return nil
+}
+
+type IssueTokenOutput struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -1,9 +1,11 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -57,6 +59,39 @@ func (i *GetBannerInput) FromURI(r *http.Request) error {
 
 type GetBannerOutput string
 
+// MaxUserBannersFeatures limits the number of features requested at once.
+const MaxUserBannersFeatures = 100
+
+type GetUserBannersInput struct {
+	TagId           int   `json:"tag_id"`
+	FeatureIds      []int `json:"feature_ids"`
+	UseLastRevision bool  `json:"use_last_revision"`
+}
+
+func (i GetUserBannersInput) Bind(r *http.Request) error {
+	return i.Validate()
+}
+
+func (i GetUserBannersInput) Validate() error {
+	if len(i.FeatureIds) == 0 {
+		return fmt.Errorf("feature_ids are empty")
+	}
+	if len(i.FeatureIds) > MaxUserBannersFeatures {
+		return fmt.Errorf("feature_ids are more than %d", MaxUserBannersFeatures)
+	}
+	uniqueFeatures := make(map[int]struct{})
+	for _, feature := range i.FeatureIds {
+		if _, ok := uniqueFeatures[feature]; ok {
+			return fmt.Errorf("feature_ids are not unique")
+		}
+		uniqueFeatures[feature] = struct{}{}
+	}
+	return nil
+}
+
+// GetUserBannersOutput maps feature_id to the banner content.
+type GetUserBannersOutput map[int]json.RawMessage
+
 type GetBannersInput struct {
 	TagId     *int
 	FeatureId *int
@@ -113,6 +148,10 @@ type CreateBannerInput struct {
 }
 
 func (b CreateBannerInput) Bind(r *http.Request) error {
+	return b.Validate()
+}
+
+func (b CreateBannerInput) Validate() error {
 	uniqueTags := make(map[int]struct{})
 	for _, tag := range b.TagIds {
 		if _, ok := uniqueTags[tag]; ok {
@@ -138,6 +177,10 @@ type UpdateBannerInput struct {
 }
 
 func (b UpdateBannerInput) Bind(r *http.Request) error {
+	return b.Validate()
+}
+
+func (b UpdateBannerInput) Validate() error {
 	if b.TagIds != nil {
 		uniqueTags := make(map[int]struct{})
 		for _, tag := range *b.TagIds {
@@ -149,3 +192,74 @@ func (b UpdateBannerInput) Bind(r *http.Request) error {
 	}
 	return nil
 }
+
+// Banner change events.
+const (
+	BannerCreated     = "created"
+	BannerUpdated     = "updated"
+	BannerActivated   = "activated"
+	BannerDeactivated = "deactivated"
+	BannerDeleted     = "deleted"
+)
+
+// BannerEvents lists lifecycle events written to outbox in the same transaction as banner changes.
+var BannerEvents = []string{
+	BannerCreated,
+	BannerUpdated,
+	BannerActivated,
+	BannerDeactivated,
+	BannerDeleted,
+}
+
+// BannerChange describes a change of banner.
+type BannerChange struct {
+	Id    int    `json:"-"`
+	TxId  int64  `json:"-"`
+	Event string `json:"-"`
+
+	BannerId  int   `json:"banner_id"`
+	FeatureId int   `json:"feature_id"`
+	TagIds    []int `json:"tag_ids"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c BannerChange) Cursor() BannerChangeCursor {
+	return BannerChangeCursor{TxId: c.TxId, Id: c.Id}
+}
+
+// BannerChangeCursor is a position in the banner changes stream ordered by transaction id and change id.
+type BannerChangeCursor struct {
+	TxId int64
+	Id   int
+}
+
+func (c BannerChangeCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.TxId, c.Id)
+}
+
+func ParseBannerChangeCursor(value string) (BannerChangeCursor, error) {
+	var cursor BannerChangeCursor
+	txId, id, ok := strings.Cut(value, "-")
+	if !ok {
+		return cursor, fmt.Errorf("invalid change id %q", value)
+	}
+	var err error
+	if cursor.TxId, err = strconv.ParseInt(txId, 10, 64); err != nil {
+		return cursor, fmt.Errorf("invalid change id %q: %w", value, err)
+	}
+	if cursor.Id, err = strconv.Atoi(id); err != nil {
+		return cursor, fmt.Errorf("invalid change id %q: %w", value, err)
+	}
+	return cursor, nil
+}
+
+// BannerEvent is a banner lifecycle event stored in outbox.
+type BannerEvent struct {
+	Id       int             `json:"event_id"`
+	Event    string          `json:"event"`
+	BannerId int             `json:"banner_id"`
+	Banner   json.RawMessage `json:"banner"`
+
+	CreatedAt time.Time `json:"occurred_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type WarmUpCacheInput struct {
+	Limit int // 0 - все активные баннеры
+}
+
+func (i *WarmUpCacheInput) FromURI(r *http.Request) error {
+	limitParam := r.URL.Query().Get("limit")
+	if limitParam == "" {
+		return nil
+	}
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil {
+		return err
+	}
+	if limit < 0 {
+		return fmt.Errorf("limit should not be negative")
+	}
+	i.Limit = limit
+	return nil
+}
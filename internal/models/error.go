@@ -11,7 +11,8 @@ type ErrResponse struct {
 	Err            error `json:"-"` // low-level runtime error
 	HTTPStatusCode int   `json:"-"` // http response status code
 
-	ErrorText string `json:"error,omitempty"` // application error message
+	ErrorText  string `json:"error,omitempty"`      // application error message
+	Permission string `json:"permission,omitempty"` // permission missing for the request
 }
 
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -43,6 +44,15 @@ func ErrForbidden(err error) *ErrResponse {
 	}
 }
 
+func ErrPermissionDenied(err error, permission string) *ErrResponse {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusForbidden,
+		ErrorText:      err.Error(),
+		Permission:     permission,
+	}
+}
+
 func ErrNotFound(err error) *ErrResponse {
 	return &ErrResponse{
 		Err:            err,
@@ -59,6 +69,22 @@ func ErrConflict(err error) *ErrResponse {
 	}
 }
 
+func ErrRequestEntityTooLarge(err error) *ErrResponse {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrTooManyRequests(err error) *ErrResponse {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusTooManyRequests,
+		ErrorText:      err.Error(),
+	}
+}
+
 func ErrInternalServerError(err error) *ErrResponse {
 	return &ErrResponse{
 		Err:            err,
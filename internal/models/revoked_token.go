@@ -0,0 +1,37 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RevokedToken is a token which is not accepted even with valid signature.
+type RevokedToken struct {
+	Jti       string     `json:"jti"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // после истечения токен не нужно хранить, nil - хранится всегда
+	Reason    string     `json:"reason"`
+	RevokedAt time.Time  `json:"revoked_at"`
+}
+
+// RevokeTokenInput identifies token by the token itself or by its jti claim.
+type RevokeTokenInput struct {
+	Token     string     `json:"token"`
+	Jti       string     `json:"jti"`
+	ExpiresAt *time.Time `json:"expires_at"` // используется вместе с jti
+	Reason    string     `json:"reason"`
+}
+
+func (i *RevokeTokenInput) Bind(r *http.Request) error {
+	return i.Validate()
+}
+
+func (i *RevokeTokenInput) Validate() error {
+	if i.Token == "" && i.Jti == "" {
+		return fmt.Errorf("token or jti is required")
+	}
+	if i.Token != "" && i.Jti != "" {
+		return fmt.Errorf("only one of token and jti should be given")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	Id     int      `json:"webhook_id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"-"`
+	Events []string `json:"events"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Webhooks []*Webhook
+
+type CreateWebhookInput struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"` // если не заданы, то подписка на все события
+}
+
+func (i *CreateWebhookInput) Bind(r *http.Request) error {
+	return i.Validate()
+}
+
+func (i *CreateWebhookInput) Validate() error {
+	webhookURL, err := url.Parse(i.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if webhookURL.Scheme != "http" && webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		return fmt.Errorf("url must be absolute http(s) url")
+	}
+	if i.Secret == "" {
+		return fmt.Errorf("secret is empty")
+	}
+	if len(i.Events) == 0 {
+		i.Events = BannerEvents
+	}
+	for _, event := range i.Events {
+		if !slices.Contains(BannerEvents, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+type CreateWebhookOutput struct {
+	WebhookId int `json:"webhook_id"`
+}
+
+type WebhookDelivery struct {
+	Id        int    `json:"delivery_id"`
+	WebhookId int    `json:"webhook_id"`
+	EventId   int    `json:"event_id"`
+	Event     string `json:"event"`
+	BannerId  int    `json:"banner_id"`
+
+	Status       string  `json:"status"`
+	Attempts     int     `json:"attempts"`
+	ResponseCode *int    `json:"response_code,omitempty"`
+	LastError    *string `json:"last_error,omitempty"`
+
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+
+	// Fields below are filled only for deliveries claimed by dispatcher.
+	URL            string          `json:"-"`
+	Secret         string          `json:"-"`
+	Payload        json.RawMessage `json:"-"`
+	EventCreatedAt time.Time       `json:"-"`
+}
+
+type WebhookDeliveries []*WebhookDelivery
+
+type GetWebhookDeliveriesInput struct {
+	WebhookId int
+	Status    *string
+	Limit     *int
+	Offset    *int
+}
+
+func (i *GetWebhookDeliveriesInput) FromURI(r *http.Request) error {
+	statusParam := r.URL.Query().Get("status")
+	if statusParam != "" {
+		if statusParam != DeliveryPending && statusParam != DeliveryDelivered && statusParam != DeliveryFailed {
+			return fmt.Errorf("unknown status %q", statusParam)
+		}
+		i.Status = &statusParam
+	}
+
+	limitParam := r.URL.Query().Get("limit")
+	if limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil {
+			return err
+		}
+		i.Limit = &limit
+	}
+
+	offsetParam := r.URL.Query().Get("offset")
+	if offsetParam != "" {
+		offset, err := strconv.Atoi(offsetParam)
+		if err != nil {
+			return err
+		}
+		i.Offset = &offset
+	}
+	return nil
+}
+
+// WebhookPayload is a body of the webhook request.
+type WebhookPayload struct {
+	DeliveryId int             `json:"delivery_id"`
+	EventId    int             `json:"event_id"`
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Banner     json.RawMessage `json:"banner"`
+}
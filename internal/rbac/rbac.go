@@ -0,0 +1,259 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+var (
+	ErrPermissionDenied  = errors.New("missing permission")
+	ErrFeatureOutOfScope = errors.New("feature is out of scope")
+)
+
+// Permission allows an action with banners or webhooks.
+type Permission string
+
+const (
+	ReadUserBanner     Permission = "user_banner:read"
+	ReadInactiveBanner Permission = "banner:read_inactive" // выключенные баннеры в пользовательских методах
+	ListBanners        Permission = "banner:list"
+	CreateBanner       Permission = "banner:create"
+	UpdateBanner       Permission = "banner:update"
+	PublishBanner      Permission = "banner:publish"
+	DeleteBanner       Permission = "banner:delete"
+	ManageWebhooks     Permission = "webhook:manage"
+	ManageAPIKeys      Permission = "api_key:manage"
+	RevokeTokens       Permission = "token:revoke"
+	ReadAudit          Permission = "audit:read"
+	WarmUpCache        Permission = "cache:warmup"
+)
+
+var Permissions = []Permission{
+	ReadUserBanner,
+	ReadInactiveBanner,
+	ListBanners,
+	CreateBanner,
+	UpdateBanner,
+	PublishBanner,
+	DeleteBanner,
+	ManageWebhooks,
+	ManageAPIKeys,
+	RevokeTokens,
+	ReadAudit,
+	WarmUpCache,
+}
+
+// IsPermission reports whether permission is known.
+func IsPermission(permission Permission) bool {
+	return slices.Contains(Permissions, permission)
+}
+
+// Roles of default policy.
+const (
+	RoleUser      = "user"
+	RoleViewer    = "viewer"
+	RoleEditor    = "editor"
+	RolePublisher = "publisher"
+	RoleOwner     = "owner"
+)
+
+// Policy maps roles to their permissions and teams to features they own.
+type Policy struct {
+	roles map[string]map[Permission]struct{}
+	teams map[string][]int
+}
+
+// DefaultPolicy returns policy where each admin role extends the previous one: viewer, editor, publisher, owner.
+func DefaultPolicy() *Policy {
+	viewer := []Permission{ReadUserBanner, ReadInactiveBanner, ListBanners}
+	editor := slices.Concat(viewer, []Permission{CreateBanner, UpdateBanner})
+	publisher := slices.Concat(editor, []Permission{PublishBanner})
+	owner := slices.Concat(publisher, []Permission{DeleteBanner, ManageWebhooks, ManageAPIKeys, RevokeTokens, ReadAudit, WarmUpCache})
+
+	policy, _ := NewPolicy(map[string][]Permission{
+		RoleUser:      {ReadUserBanner},
+		RoleViewer:    viewer,
+		RoleEditor:    editor,
+		RolePublisher: publisher,
+		RoleOwner:     owner,
+	})
+	return policy
+}
+
+func NewPolicy(roles map[string][]Permission) (*Policy, error) {
+	policy := &Policy{roles: make(map[string]map[Permission]struct{}, len(roles))}
+	for role, permissions := range roles {
+		if role == "" {
+			return nil, errors.New("empty role name")
+		}
+		policy.roles[role] = make(map[Permission]struct{}, len(permissions))
+		for _, permission := range permissions {
+			if !IsPermission(permission) {
+				return nil, fmt.Errorf("unknown permission %q of role %q", permission, role)
+			}
+			policy.roles[role][permission] = struct{}{}
+		}
+	}
+	return policy, nil
+}
+
+// LoadPolicy reads policy from JSON file like {"viewer": ["banner:list"], "owner": ["banner:list", "banner:delete"]}.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read RBAC policy file: %w", err)
+	}
+	roles := make(map[string][]Permission)
+	if err = json.Unmarshal(data, &roles); err != nil {
+		return nil, fmt.Errorf("couldn't parse RBAC policy file: %w", err)
+	}
+	policy, err := NewPolicy(roles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RBAC policy: %w", err)
+	}
+	return policy, nil
+}
+
+// SetTeamFeatures sets features owned by teams, tokens with teams claim are limited to them.
+func (p *Policy) SetTeamFeatures(teams map[string][]int) {
+	p.teams = teams
+}
+
+// LoadTeamFeatures reads features of teams from JSON file like {"promo": [1, 2], "search": [3]}.
+func LoadTeamFeatures(path string) (map[string][]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read team features file: %w", err)
+	}
+	teams := make(map[string][]int)
+	if err = json.Unmarshal(data, &teams); err != nil {
+		return nil, fmt.Errorf("couldn't parse team features file: %w", err)
+	}
+	return teams, nil
+}
+
+// FeatureScope returns features available with given features and teams of token.
+// Token without both of them is not limited and gets nil scope.
+func (p *Policy) FeatureScope(features []int, teams []string) FeatureScope {
+	if features == nil && teams == nil {
+		return nil
+	}
+	scope := make(FeatureScope, len(features))
+	for _, featureId := range features {
+		scope[featureId] = struct{}{}
+	}
+	for _, team := range teams {
+		for _, featureId := range p.teams[team] {
+			scope[featureId] = struct{}{}
+		}
+	}
+	return scope
+}
+
+// HasRole reports whether role is defined by the policy.
+func (p *Policy) HasRole(role string) bool {
+	_, ok := p.roles[role]
+	return ok
+}
+
+// Allowed reports whether principal's role has permission and it is not excluded by principal's scopes.
+func (p *Policy) Allowed(principal *Principal, permission Permission) bool {
+	if _, ok := p.roles[principal.Role][permission]; !ok {
+		return false
+	}
+	return principal.Scopes == nil || slices.Contains(principal.Scopes, permission)
+}
+
+// Check returns ErrPermissionDenied with permission name if principal doesn't have it.
+func (p *Policy) Check(principal *Principal, permission Permission) error {
+	if !p.Allowed(principal, permission) {
+		return fmt.Errorf("%w %s", ErrPermissionDenied, permission)
+	}
+	return nil
+}
+
+// CheckDelegation returns ErrPermissionDenied if credentials with given role and scopes would have a permission
+// which caller doesn't have, e.g. a user creating an owner API key.
+func (p *Policy) CheckDelegation(caller *Principal, role string, scopes []Permission) error {
+	if caller.Scopes != nil {
+		if scopes == nil {
+			return fmt.Errorf("%w: scopes are required", ErrPermissionDenied)
+		}
+		for _, scope := range scopes {
+			if !slices.Contains(caller.Scopes, scope) {
+				return fmt.Errorf("%w %s", ErrPermissionDenied, scope)
+			}
+		}
+	}
+	delegated := &Principal{Role: role, Scopes: scopes}
+	for _, permission := range Permissions {
+		if p.Allowed(delegated, permission) && !p.Allowed(caller, permission) {
+			return fmt.Errorf("%w %s", ErrPermissionDenied, permission)
+		}
+	}
+	return nil
+}
+
+// FeatureScope is a set of features available to principal, nil scope allows any feature.
+type FeatureScope map[int]struct{}
+
+func (s FeatureScope) Contains(featureId int) bool {
+	if s == nil {
+		return true
+	}
+	_, ok := s[featureId]
+	return ok
+}
+
+// FeatureIds returns sorted features of the scope, nil for not limited scope.
+func (s FeatureScope) FeatureIds() []int {
+	if s == nil {
+		return nil
+	}
+	featureIds := make([]int, 0, len(s))
+	for featureId := range s {
+		featureIds = append(featureIds, featureId)
+	}
+	slices.Sort(featureIds)
+	return featureIds
+}
+
+// Principal is an authenticated caller of the API.
+type Principal struct {
+	Role     string
+	Features FeatureScope
+	Scopes   []Permission // если заданы, то из прав роли доступны только они
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns caller set by authorization middleware.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
+
+// ScopeFromContext returns features available to principal, calls without principal are internal and not limited.
+func ScopeFromContext(ctx context.Context) FeatureScope {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return principal.Features
+}
+
+// CheckFeature returns ErrFeatureOutOfScope if principal from context can't change banners of the feature.
+func CheckFeature(ctx context.Context, featureId int) error {
+	if !ScopeFromContext(ctx).Contains(featureId) {
+		return fmt.Errorf("%w: %d", ErrFeatureOutOfScope, featureId)
+	}
+	return nil
+}
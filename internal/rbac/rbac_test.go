@@ -0,0 +1,78 @@
+package rbac
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	policy := DefaultPolicy()
+
+	assert.True(t, policy.Allowed(&Principal{Role: RoleUser}, ReadUserBanner))
+	assert.False(t, policy.Allowed(&Principal{Role: RoleUser}, ReadInactiveBanner))
+	assert.True(t, policy.Allowed(&Principal{Role: RoleViewer}, ListBanners))
+	assert.False(t, policy.Allowed(&Principal{Role: RoleViewer}, CreateBanner))
+	assert.True(t, policy.Allowed(&Principal{Role: RoleEditor}, UpdateBanner))
+	assert.False(t, policy.Allowed(&Principal{Role: RoleEditor}, PublishBanner))
+	assert.True(t, policy.Allowed(&Principal{Role: RolePublisher}, PublishBanner))
+	assert.False(t, policy.Allowed(&Principal{Role: RolePublisher}, DeleteBanner))
+	for _, permission := range Permissions {
+		assert.True(t, policy.Allowed(&Principal{Role: RoleOwner}, permission))
+	}
+
+	err := policy.Check(&Principal{Role: RoleEditor}, DeleteBanner)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.EqualError(t, err, "missing permission banner:delete")
+
+	// scopes только сужают права роли
+	scoped := &Principal{Role: RoleEditor, Scopes: []Permission{ListBanners, DeleteBanner}}
+	assert.True(t, policy.Allowed(scoped, ListBanners))
+	assert.False(t, policy.Allowed(scoped, CreateBanner))
+	assert.False(t, policy.Allowed(scoped, DeleteBanner))
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"auditor": ["banner:list"], "support": ["user_banner:read", "banner:read_inactive"]}`), 0o600))
+	policy, err := LoadPolicy(path)
+	require.NoError(t, err)
+	assert.True(t, policy.HasRole("auditor"))
+	assert.False(t, policy.HasRole(RoleOwner))
+	assert.True(t, policy.Allowed(&Principal{Role: "auditor"}, ListBanners))
+	assert.False(t, policy.Allowed(&Principal{Role: "auditor"}, ReadUserBanner))
+	assert.True(t, policy.Allowed(&Principal{Role: "support"}, ReadInactiveBanner))
+
+	path = filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"auditor": ["banner:everything"]}`), 0o600))
+	_, err = LoadPolicy(path)
+	assert.ErrorContains(t, err, "banner:everything")
+}
+
+func TestFeatureScope(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.SetTeamFeatures(map[string][]int{"promo": {1, 2}, "search": {3}})
+
+	assert.Nil(t, policy.FeatureScope(nil, nil))
+	assert.True(t, policy.FeatureScope(nil, nil).Contains(100))
+
+	scope := policy.FeatureScope([]int{5}, []string{"promo", "unknown"})
+	assert.Equal(t, []int{1, 2, 5}, scope.FeatureIds())
+	assert.False(t, scope.Contains(3))
+
+	// пустой список фич в токене не дает доступа ни к одной фиче
+	assert.Empty(t, policy.FeatureScope([]int{}, nil).FeatureIds())
+	assert.NotNil(t, policy.FeatureScope([]int{}, nil).FeatureIds())
+
+	ctx := context.Background()
+	assert.NoError(t, CheckFeature(ctx, 3))
+	ctx = WithPrincipal(ctx, &Principal{Role: RoleOwner, Features: scope})
+	assert.NoError(t, CheckFeature(ctx, 1))
+	assert.ErrorIs(t, CheckFeature(ctx, 3), ErrFeatureOutOfScope)
+}
@@ -1,8 +1,30 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"time"
+)
+
+// CachedBanner is a content of banner for feature and tag.
+type CachedBanner struct {
+	FeatureId int
+	TagId     int
+	Content   string
+}
 
 type Cache interface {
 	GetBanner(ctx context.Context, featureId, tagId int) (*string, error)
+	// SetBanner caches banner content and keeps its last known good copy for longer.
 	SetBanner(ctx context.Context, featureId, tagId int, bannerContent *string) error
+	// GetStaleBanner returns last known good copy of banner content to serve when database is unavailable.
+	GetStaleBanner(ctx context.Context, featureId, tagId int) (*string, error)
+	GetBannersByFeatures(ctx context.Context, featureIds []int, tagId int) (map[int]string, error)
+	SetBannersByFeatures(ctx context.Context, tagId int, bannersContent map[int]string) error
+	// SetBanners caches batch of banners with any features and tags.
+	SetBanners(ctx context.Context, banners []CachedBanner) error
+	// DeleteBanners removes cached banners with their last known good copies.
+	DeleteBanners(ctx context.Context, featureId int, tagIds []int) error
+	// SetRevokedToken marks token as revoked for given duration, zero expiration means no expiration.
+	SetRevokedToken(ctx context.Context, jti string, expiration time.Duration) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
 }
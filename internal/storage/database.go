@@ -7,8 +7,33 @@ import (
 
 type Database interface {
 	GetBanner(ctx context.Context, featureId int, tagId int, isActive *bool) (*models.Banner, error)
-	GetBanners(ctx context.Context, featureId *int, tagId *int, limit *int, offset *int) (*models.Banners, error)
+	GetBannerById(ctx context.Context, bannerId int) (*models.Banner, error)
+	GetBannersByFeatures(ctx context.Context, featureIds []int, tagId int, isActive *bool) (map[int]*models.Banner, error)
+	// StreamActiveBanners calls fn for content of each active banner, recently updated first, limit bounds count if positive.
+	StreamActiveBanners(ctx context.Context, limit int, fn func(banner CachedBanner) error) error
+	// GetBanners returns banners filtered by feature and tag, featureIds limits features if not nil.
+	GetBanners(ctx context.Context, featureId *int, tagId *int, featureIds []int, limit *int, offset *int) (*models.Banners, error)
 	CreateBanner(ctx context.Context, banner *models.Banner) (*models.Banner, error)
 	UpdateBanner(ctx context.Context, banner *models.UpdateBannerInput) error
 	DeleteBanner(ctx context.Context, bannerId int) error
+	// GetBannerChanges returns changes after the cursor, featureIds limits features if not nil.
+	GetBannerChanges(ctx context.Context, after models.BannerChangeCursor, featureIds []int, limit int) ([]*models.BannerChange, error)
+	GetLastBannerChangeCursor(ctx context.Context) (models.BannerChangeCursor, error)
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error)
+	GetWebhooks(ctx context.Context) (models.Webhooks, error)
+	DeleteWebhook(ctx context.Context, webhookId int) error
+	GetWebhookDeliveries(ctx context.Context, webhookId int, status *string, limit *int, offset *int) (models.WebhookDeliveries, error)
+	CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error)
+	// GetAPIKeys returns API keys, featureIds limits them to keys of these features if not nil.
+	GetAPIKeys(ctx context.Context, featureIds []int) (models.APIKeys, error)
+	// GetActiveAPIKey returns not revoked API key by its hash and marks it as used.
+	GetActiveAPIKey(ctx context.Context, hash string) (*models.APIKey, error)
+	// RevokeAPIKey revokes active API key, featureIds limits it to keys of these features if not nil.
+	RevokeAPIKey(ctx context.Context, keyId int, featureIds []int) error
+	RevokeToken(ctx context.Context, token *models.RevokedToken) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// GetRevokedTokens returns revoked tokens which are not expired yet.
+	GetRevokedTokens(ctx context.Context) ([]*models.RevokedToken, error)
+	// GetAuditRecords returns audit records of banner changes matching the filter, starting from the latest.
+	GetAuditRecords(ctx context.Context, filter *models.GetAuditInput) (models.AuditRecords, error)
 }
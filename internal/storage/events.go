@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+// EventOutbox is used by event relay to publish banner events from outbox.
+type EventOutbox interface {
+	// ClaimBannerEvents takes relay lease for given time and returns its holder with up to limit not yet published
+	// outbox events ordered by id. Holder is empty if the lease is taken by another relay.
+	ClaimBannerEvents(ctx context.Context, limit int, lease time.Duration) (string, []*models.BannerEvent, error)
+	// FinishBannerEvents marks events as published and releases the lease of holder.
+	FinishBannerEvents(ctx context.Context, holder string, published []int) error
+}
+
+// OutboxCleaner is used to remove processed events from outbox.
+type OutboxCleaner interface {
+	// DeleteProcessedEvents removes up to limit events created more than retention ago, which are dispatched to webhooks
+	// with no pending deliveries and, if published is true, are published by relay. Finished deliveries of removed events
+	// are removed too. Returns count of removed events.
+	DeleteProcessedEvents(ctx context.Context, retention time.Duration, published bool, limit int) (int, error)
+}
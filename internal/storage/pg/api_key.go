@@ -0,0 +1,120 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+var (
+	insertAPIKeyQuery = `insert into api_key(prefix, key_hash, role, scopes, feature_ids, description)
+		values (@prefix, @key_hash, @role, @scopes, @feature_ids, @description) returning id, created_at`
+
+	// ключи с ограниченной областью фич видны только ключам, чья область их включает
+	getAPIKeysQuery = `select id, prefix, role, scopes, feature_ids, description, created_at, last_used_at, revoked_at
+		from api_key
+		where (@feature_ids::integer[] is NULL) or (feature_ids is not NULL and feature_ids <@ @feature_ids)
+		order by id`
+
+	// getActiveAPIKeyQuery returns not revoked key by hash and updates its last usage time,
+	// the time is written at most once a minute to avoid a write on every request.
+	getActiveAPIKeyQuery = `with key as (
+    select id, prefix, role, scopes, feature_ids, description, created_at, last_used_at from api_key
+    where key_hash=$1 and revoked_at is NULL
+), touched as (
+    update api_key set last_used_at=now()
+    where id in (select id from key where last_used_at is NULL or last_used_at < now() - interval '1 minute')
+)
+select id, prefix, role, scopes, feature_ids, description, created_at, last_used_at from key`
+
+	revokeAPIKeyQuery = `update api_key set revoked_at=now() where id=@id and revoked_at is NULL
+		and ((@feature_ids::integer[] is NULL) or (feature_ids is not NULL and feature_ids <@ @feature_ids))`
+)
+
+func (p *PGStorage) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	err := p.connection.QueryRow(
+		ctx,
+		insertAPIKeyQuery,
+		pgx.NamedArgs{
+			"prefix":      key.Prefix,
+			"key_hash":    key.Hash,
+			"role":        key.Role,
+			"scopes":      key.Scopes,
+			"feature_ids": key.FeatureIds,
+			"description": key.Description,
+		},
+	).Scan(&key.Id, &key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't insert API key: %w", err)
+	}
+	return key, nil
+}
+
+func (p *PGStorage) GetAPIKeys(ctx context.Context, featureIds []int) (models.APIKeys, error) {
+	rows, err := p.connection.Query(ctx, getAPIKeysQuery, pgx.NamedArgs{"feature_ids": featureIds})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := models.APIKeys{}
+	for rows.Next() {
+		key := &models.APIKey{}
+		err = rows.Scan(
+			&key.Id,
+			&key.Prefix,
+			&key.Role,
+			&key.Scopes,
+			&key.FeatureIds,
+			&key.Description,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+			&key.RevokedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get API keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (p *PGStorage) GetActiveAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	key := &models.APIKey{Hash: hash}
+	err := p.connection.QueryRow(ctx, getActiveAPIKeyQuery, hash).Scan(
+		&key.Id,
+		&key.Prefix,
+		&key.Role,
+		&key.Scopes,
+		&key.FeatureIds,
+		&key.Description,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("API key: %w", storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get API key: %w", err)
+	}
+	return key, nil
+}
+
+func (p *PGStorage) RevokeAPIKey(ctx context.Context, keyId int, featureIds []int) error {
+	result, err := p.connection.Exec(ctx, revokeAPIKeyQuery, pgx.NamedArgs{"id": keyId, "feature_ids": featureIds})
+	if err != nil {
+		return fmt.Errorf("couldn't revoke API key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("active API key with given id (%d): %w", keyId, storage.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/unbeman/av-banner-task/internal/audit"
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+var (
+	insertAuditRecordQuery = `insert into audit_log(action, banner_id, actor, request_id, changes)
+		values (@action, @banner_id, @actor, @request_id, @changes)`
+
+	getAuditRecordsQuery = `select id, action, banner_id, actor, request_id, changes, created_at from audit_log
+		where ((@banner_id::integer is NULL) or (banner_id=@banner_id))
+			and ((@actor::varchar is NULL) or (actor=@actor))
+			and ((@from::timestamptz is NULL) or (created_at>=@from))
+			and ((@to::timestamptz is NULL) or (created_at<@to))
+		order by id desc
+		limit @limit offset @offset`
+)
+
+// writeAuditRecord saves banner change with actor from context within the transaction of the change.
+func writeAuditRecord(ctx context.Context, tx pgx.Tx, action string, bannerId int, before, after *models.Banner) error {
+	changes, err := json.Marshal(models.BannerDiff(before, after))
+	if err != nil {
+		return fmt.Errorf("couldn't marshal audit changes: %w", err)
+	}
+	info := audit.FromContext(ctx)
+	_, err = tx.Exec(
+		ctx,
+		insertAuditRecordQuery,
+		pgx.NamedArgs{
+			"action":     action,
+			"banner_id":  bannerId,
+			"actor":      info.Actor,
+			"request_id": info.RequestId,
+			"changes":    changes,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't write audit record: %w", err)
+	}
+	return nil
+}
+
+// GetAuditRecords returns audit records matching the filter, starting from the latest.
+func (p *PGStorage) GetAuditRecords(ctx context.Context, filter *models.GetAuditInput) (models.AuditRecords, error) {
+	rows, err := p.connection.Query(
+		ctx,
+		getAuditRecordsQuery,
+		pgx.NamedArgs{
+			"banner_id": filter.BannerId,
+			"actor":     filter.Actor,
+			"from":      filter.From,
+			"to":        filter.To,
+			"limit":     filter.Limit,
+			"offset":    filter.Offset,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get audit records: %w", err)
+	}
+	defer rows.Close()
+
+	records := models.AuditRecords{}
+	for rows.Next() {
+		record := &models.AuditRecord{}
+		err = rows.Scan(
+			&record.Id,
+			&record.Action,
+			&record.BannerId,
+			&record.Actor,
+			&record.RequestId,
+			&record.Changes,
+			&record.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan audit record: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get audit records: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,123 @@
+package pg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+var (
+	// аренда перехватывается только после истечения, поэтому события публикует один relay
+	acquireRelayLeaseQuery = `insert into outbox_relay_lease (id, holder, expires_at) values (true, @holder, now() + @lease::interval)
+		on conflict (id) do update set holder=excluded.holder, expires_at=excluded.expires_at
+		where outbox_relay_lease.expires_at < now()`
+
+	releaseRelayLeaseQuery = `delete from outbox_relay_lease where holder=$1`
+
+	getUnpublishedEventsQuery = `select id, event, banner_id, payload, created_at from banner_outbox
+		where published_at is NULL order by id limit $1`
+
+	markEventsPublishedQuery = `update banner_outbox set published_at=now() where id=any($1)`
+
+	// deleteProcessedEventsQuery removes expired events together with their finished webhook deliveries,
+	// foreign key is checked at the end of statement.
+	deleteProcessedEventsQuery = `with expired as (
+    select o.id from banner_outbox as o
+    where o.created_at < now() - @retention::interval
+        and o.webhooks_dispatched_at is not NULL
+        and (o.published_at is not NULL or not @published)
+        and not exists (select 1 from webhook_delivery as d where d.outbox_id = o.id and d.status = 'pending')
+    order by o.id
+    limit @limit
+    for update skip locked
+), deliveries as (
+    delete from webhook_delivery where outbox_id in (select id from expired)
+)
+delete from banner_outbox where id in (select id from expired)`
+)
+
+func (p *PGStorage) ClaimBannerEvents(ctx context.Context, limit int, lease time.Duration) (string, []*models.BannerEvent, error) {
+	holder, err := newLeaseHolder()
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := p.connection.Exec(ctx, acquireRelayLeaseQuery, pgx.NamedArgs{"holder": holder, "lease": lease})
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't acquire relay lease: %w", err)
+	}
+	if result.RowsAffected() == 0 { // события публикует другой экземпляр сервиса
+		return "", nil, nil
+	}
+
+	rows, err := p.connection.Query(ctx, getUnpublishedEventsQuery, limit)
+	if err != nil {
+		p.releaseRelayLease(ctx, holder)
+		return "", nil, fmt.Errorf("couldn't get unpublished events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.BannerEvent, error) {
+		event := &models.BannerEvent{}
+		err := row.Scan(&event.Id, &event.Event, &event.BannerId, &event.Banner, &event.CreatedAt)
+		return event, err
+	})
+	if err != nil {
+		p.releaseRelayLease(ctx, holder)
+		return "", nil, fmt.Errorf("couldn't scan unpublished event: %w", err)
+	}
+	return holder, events, nil
+}
+
+func (p *PGStorage) FinishBannerEvents(ctx context.Context, holder string, published []int) error {
+	tx, err := p.connection.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, markEventsPublishedQuery, published); err != nil {
+		return fmt.Errorf("couldn't mark events published: %w", err)
+	}
+	if _, err = tx.Exec(ctx, releaseRelayLeaseQuery, holder); err != nil {
+		return fmt.Errorf("couldn't release relay lease: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("couldn't commit published events: %w", err)
+	}
+	return nil
+}
+
+func (p *PGStorage) releaseRelayLease(ctx context.Context, holder string) {
+	if _, err := p.connection.Exec(ctx, releaseRelayLeaseQuery, holder); err != nil {
+		log.Errorf("couldn't release relay lease: %v", err)
+	}
+}
+
+func newLeaseHolder() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("couldn't generate lease holder: %w", err)
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func (p *PGStorage) DeleteProcessedEvents(ctx context.Context, retention time.Duration, published bool, limit int) (int, error) {
+	result, err := p.connection.Exec(
+		ctx,
+		deleteProcessedEventsQuery,
+		pgx.NamedArgs{
+			"retention": retention,
+			"published": published,
+			"limit":     limit,
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't delete processed outbox events: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
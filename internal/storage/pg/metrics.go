@@ -0,0 +1,39 @@
+package pg
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	poolAcquiredConnsDesc = prometheus.NewDesc("pgxpool_acquired_conns", "Count of connections acquired from the pool.", nil, nil)
+	poolIdleConnsDesc     = prometheus.NewDesc("pgxpool_idle_conns", "Count of idle connections in the pool.", nil, nil)
+	poolTotalConnsDesc    = prometheus.NewDesc("pgxpool_total_conns", "Total count of connections in the pool.", nil, nil)
+	poolMaxConnsDesc      = prometheus.NewDesc("pgxpool_max_conns", "Maximum size of the pool.", nil, nil)
+	poolAcquireCountDesc  = prometheus.NewDesc("pgxpool_acquire_total", "Count of successful acquires from the pool.", nil, nil)
+	poolAcquireWaitDesc   = prometheus.NewDesc("pgxpool_acquire_wait_seconds_total", "Total time waited for connections.", nil, nil)
+	poolEmptyAcquireDesc  = prometheus.NewDesc("pgxpool_empty_acquire_total", "Count of acquires which waited for a connection.", nil, nil)
+	poolCanceledDesc      = prometheus.NewDesc("pgxpool_canceled_acquire_total", "Count of acquires canceled by context.", nil, nil)
+)
+
+// Describe implements prometheus.Collector for connection pool stats.
+func (p *PGStorage) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredConnsDesc
+	ch <- poolIdleConnsDesc
+	ch <- poolTotalConnsDesc
+	ch <- poolMaxConnsDesc
+	ch <- poolAcquireCountDesc
+	ch <- poolAcquireWaitDesc
+	ch <- poolEmptyAcquireDesc
+	ch <- poolCanceledDesc
+}
+
+// Collect implements prometheus.Collector for connection pool stats.
+func (p *PGStorage) Collect(ch chan<- prometheus.Metric) {
+	stat := p.connection.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConnsDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConnsDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConnsDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireCountDesc, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireWaitDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquireDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledDesc, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
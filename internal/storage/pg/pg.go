@@ -2,6 +2,7 @@ package pg
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -20,6 +21,23 @@ var (
 		inner join "banner_feature_tags" bft on b.id = bft.banner_id
 		where bft.feature_id=$1 and bft.tag_id=$2 and (($3::bool is NULL) or (b.is_active=$3))`
 
+	getBannerByIdQuery = `select
+    binfo.id,
+    binfo.feature_id,
+    binfo.is_active,
+    binfo.content,
+    binfo.created_at,
+    binfo.updated_at,
+    array(select sbft.tag_id from banner_feature_tags as sbft where sbft.banner_id=binfo.id) as tags
+from banner as binfo
+where binfo.id=$1`
+
+	getBannerByIdForUpdateQuery = getBannerByIdQuery + ` for update of binfo`
+
+	getBannersByFeaturesQuery = `select bft.feature_id, b.content, b.is_active from "banner" as b 
+		inner join "banner_feature_tags" bft on b.id = bft.banner_id
+		where bft.feature_id=any($1) and bft.tag_id=$2 and (($3::bool is NULL) or (b.is_active=$3))`
+
 	getBannersWithFilterByTagId = `select
     bft.banner_id,
     bft.feature_id,
@@ -39,6 +57,7 @@ from banner_feature_tags as bft
             ) as tags
         ) as lbft
 where ((@feature_id::integer is NULL) or (bft.feature_id=@feature_id)) and bft.tag_id=@tag_id 
+    and ((@feature_ids::integer[] is NULL) or (bft.feature_id=any(@feature_ids)))
 limit @limit 
 offset @offset`
 
@@ -59,11 +78,12 @@ from banner as binfo
                 where sbft.banner_id=binfo.id and sbft.feature_id=binfo.feature_id
             ) as tags
         ) as lbft
-where ((@feature_id::integer is NULL) or (binfo.feature_id=$1))
+where ((@feature_id::integer is NULL) or (binfo.feature_id=@feature_id))
+    and ((@feature_ids::integer[] is NULL) or (binfo.feature_id=any(@feature_ids)))
 limit @limit 
 offset @offset`
 
-	insertBanner = `insert into banner(feature_id, is_active, content) values (@feature_id, @is_active, @content) returning id`
+	insertBanner = `insert into banner(feature_id, is_active, content) values (@feature_id, @is_active, @content) returning id, created_at, updated_at`
 
 	updateBannerActiveQuery  = `update banner set is_active=$1 where id=$2`
 	updateBannerContentQuery = `update banner set content=$1 where id=$2`
@@ -74,14 +94,49 @@ offset @offset`
 	deleteBannerTagsQuery = `delete from banner_feature_tags where banner_id=$1`
 
 	deleteBannerByIdQuery = `delete from banner where id=$1`
+
+	insertOutboxEventQuery = `insert into banner_outbox(event, banner_id, payload) values ($1, $2, $3)`
+
+	insertBannerChangeQuery = `insert into banner_change(event, banner_id, feature_id, tag_ids) 
+		values (@event, @banner_id, @feature_id, @tag_ids)`
+
+	// изменения незавершенных транзакций и транзакций после них не отдаются, чтобы не пропустить поздние коммиты
+	getBannerChangesQuery = `select id, tx_id, event, banner_id, feature_id, tag_ids, created_at from banner_change 
+		where (tx_id, id) > (@tx_id, @id)
+		  and tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+		  and ((@feature_ids::integer[] is NULL) or (feature_id=any(@feature_ids)))
+		order by tx_id, id limit @limit`
+
+	getLastBannerChangeQuery = `select tx_id, id from banner_change 
+		where tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+		order by tx_id desc, id desc limit 1`
+
+	deleteAllBannerTagsQuery = `delete from banner_feature_tags`
+	deleteAllBannersQuery    = `delete from banner`
+
+	// таблица ведется golang-migrate
+	getMigrationVersionQuery = `select version, dirty from schema_migrations limit 1`
 )
 
+// SchemaVersion is a version of the last migration from migrations directory the code relies on.
+const SchemaVersion = 9
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type PGStorage struct {
 	connection *pgxpool.Pool
 }
 
 func NewPG(ctx context.Context, dsn string) (*PGStorage, error) {
-	connPool, err := pgxpool.New(ctx, dsn)
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
+	connPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +163,50 @@ func (p *PGStorage) GetBanner(ctx context.Context, featureId int, tagId int, isA
 	return banner, nil
 }
 
-func (p *PGStorage) GetBanners(ctx context.Context, featureId *int, tagId *int, limit *int, offset *int) (*models.Banners, error) {
+func (p *PGStorage) GetBannerById(ctx context.Context, bannerId int) (*models.Banner, error) {
+	return getBannerById(ctx, p.connection, getBannerByIdQuery, bannerId)
+}
+
+func getBannerById(ctx context.Context, q queryRower, query string, bannerId int) (*models.Banner, error) {
+	banner := &models.Banner{}
+
+	err := q.QueryRow(ctx, query, bannerId).
+		Scan(&banner.Id, &banner.FeatureId, &banner.IsActive, &banner.Content, &banner.CreatedAt, &banner.UpdateAt, &banner.TagIds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("banner with given id (%d): %w", bannerId, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get banner: %w", err)
+	}
+	return banner, nil
+}
+
+// GetBannersByFeatures returns banners for given tag and set of features with a single query.
+// Features without matching banner are absent in the result.
+func (p *PGStorage) GetBannersByFeatures(ctx context.Context, featureIds []int, tagId int, isActive *bool) (map[int]*models.Banner, error) {
+	rows, err := p.connection.Query(ctx, getBannersByFeaturesQuery, featureIds, tagId, isActive)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get banners: %w", err)
+	}
+	defer rows.Close()
+
+	banners := make(map[int]*models.Banner, len(featureIds))
+	for rows.Next() {
+		banner := &models.Banner{TagIds: []int{tagId}}
+		err = rows.Scan(&banner.FeatureId, &banner.Content, &banner.IsActive)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan banner: %w", err)
+		}
+		banners[banner.FeatureId] = banner
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get banners: %w", err)
+	}
+
+	return banners, nil
+}
+
+func (p *PGStorage) GetBanners(ctx context.Context, featureId *int, tagId *int, featureIds []int, limit *int, offset *int) (*models.Banners, error) {
 	var query string
 
 	if tagId != nil {
@@ -118,7 +216,13 @@ func (p *PGStorage) GetBanners(ctx context.Context, featureId *int, tagId *int,
 	}
 
 	banners := models.Banners{}
-	rows, err := p.connection.Query(ctx, query, pgx.NamedArgs{"feature_id": featureId, "tag_id": tagId, "limit": limit, "offset": offset})
+	rows, err := p.connection.Query(ctx, query, pgx.NamedArgs{
+		"feature_id":  featureId,
+		"tag_id":      tagId,
+		"feature_ids": featureIds,
+		"limit":       limit,
+		"offset":      offset,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("couldn't get banners: %w", err)
 	}
@@ -141,13 +245,7 @@ func (p *PGStorage) CreateBanner(ctx context.Context, banner *models.Banner) (*m
 		return nil, err
 	}
 
-	defer func() {
-		if err != nil {
-			tx.Rollback(ctx)
-		} else {
-			tx.Commit(ctx)
-		}
-	}()
+	defer tx.Rollback(ctx)
 
 	err = tx.QueryRow(
 		ctx,
@@ -157,7 +255,7 @@ func (p *PGStorage) CreateBanner(ctx context.Context, banner *models.Banner) (*m
 			"is_active":  banner.IsActive,
 			"content":    banner.Content,
 		},
-	).Scan(&banner.Id)
+	).Scan(&banner.Id, &banner.CreatedAt, &banner.UpdateAt)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't insert banner: %w", checkConflictErr(err))
 	}
@@ -175,10 +273,56 @@ func (p *PGStorage) CreateBanner(ctx context.Context, banner *models.Banner) (*m
 
 	}
 
-	return banner, err
+	err = writeOutboxEvent(ctx, tx, models.BannerCreated, banner)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeAuditRecord(ctx, tx, models.AuditCreate, banner.Id, nil, banner)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeBannerChange(ctx, tx, models.BannerCreated, banner)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("couldn't commit banner creation: %w", checkConflictErr(err))
+	}
+	return banner, nil
+}
+
+func writeOutboxEvent(ctx context.Context, tx pgx.Tx, event string, banner *models.Banner) error {
+	payload, err := json.Marshal(banner)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal banner event: %w", err)
+	}
+	_, err = tx.Exec(ctx, insertOutboxEventQuery, event, banner.Id, payload)
+	if err != nil {
+		return fmt.Errorf("couldn't write banner event to outbox: %w", err)
+	}
+	return nil
 }
 
-func (p *PGStorage) updateBannerFeaturesAndTags(ctx context.Context, tx pgx.Tx, banner *models.UpdateBannerInput) error {
+// bannerUpdateEvents returns lifecycle events caused by the update of banner.
+func bannerUpdateEvents(old *models.Banner, update *models.UpdateBannerInput) []string {
+	var events []string
+	if update.IsActive != nil && *update.IsActive != old.IsActive {
+		if *update.IsActive {
+			events = append(events, models.BannerActivated)
+		} else {
+			events = append(events, models.BannerDeactivated)
+		}
+	}
+	if update.FeatureId != nil || update.TagIds != nil || update.Content != nil {
+		events = append(events, models.BannerUpdated)
+	}
+	return events
+}
+
+func (p *PGStorage) updateBannerFeaturesAndTags(ctx context.Context, tx pgx.Tx, banner *models.UpdateBannerInput, currentFeatureId int) error {
 	switch {
 	case banner.FeatureId != nil && banner.TagIds != nil: // обновить и фичу и тэги
 		_, err := tx.Exec(ctx, updateBannerFeatureQuery, banner.FeatureId, banner.Id) // обвновляем фичу в баннере
@@ -214,7 +358,7 @@ func (p *PGStorage) updateBannerFeaturesAndTags(ctx context.Context, tx pgx.Tx,
 			pgx.Identifier{"banner_feature_tags"},
 			[]string{"banner_id", "feature_id", "tag_id"},
 			pgx.CopyFromSlice(len(*banner.TagIds), func(i int) ([]interface{}, error) {
-				return []interface{}{banner.Id, banner.FeatureId, (*banner.TagIds)[i]}, nil
+				return []interface{}{banner.Id, currentFeatureId, (*banner.TagIds)[i]}, nil
 			}),
 		)
 		if err != nil {
@@ -241,9 +385,8 @@ func (p *PGStorage) updateBannerInfo(ctx context.Context, tx pgx.Tx, banner *mod
 		if err != nil {
 			return fmt.Errorf("can't update banner active: %w", err)
 		}
-		fmt.Println(cmd.RowsAffected())
 		if cmd.RowsAffected() == 0 {
-			return fmt.Errorf("banner with given id (%d): %w", storage.ErrNotFound)
+			return fmt.Errorf("banner with given id (%d): %w", banner.Id, storage.ErrNotFound)
 		}
 	}
 
@@ -253,7 +396,7 @@ func (p *PGStorage) updateBannerInfo(ctx context.Context, tx pgx.Tx, banner *mod
 			return fmt.Errorf("can't update banner content: %w", checkConflictErr(err))
 		}
 		if cmd.RowsAffected() == 0 {
-			return fmt.Errorf("banner with given id (%d): %w", storage.ErrNotFound)
+			return fmt.Errorf("banner with given id (%d): %w", banner.Id, storage.ErrNotFound)
 		}
 	}
 	return nil
@@ -265,24 +408,48 @@ func (p *PGStorage) UpdateBanner(ctx context.Context, banner *models.UpdateBanne
 		return err
 	}
 
-	defer func() {
-		if err != nil {
-			tx.Rollback(ctx)
-		} else {
-			tx.Commit(ctx)
-		}
-	}()
+	defer tx.Rollback(ctx)
+
+	old, err := getBannerById(ctx, tx, getBannerByIdForUpdateQuery, banner.Id)
+	if err != nil {
+		return err
+	}
 
 	err = p.updateBannerInfo(ctx, tx, banner)
 	if err != nil {
 		return err
 	}
 
-	err = p.updateBannerFeaturesAndTags(ctx, tx, banner)
+	err = p.updateBannerFeaturesAndTags(ctx, tx, banner, old.FeatureId)
+	if err != nil {
+		return err
+	}
+
+	updated, err := getBannerById(ctx, tx, getBannerByIdQuery, banner.Id)
+	if err != nil {
+		return err
+	}
+
+	err = writeAuditRecord(ctx, tx, models.AuditUpdate, banner.Id, old, updated)
 	if err != nil {
 		return err
 	}
 
+	for _, event := range bannerUpdateEvents(old, banner) {
+		err = writeOutboxEvent(ctx, tx, event, updated)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeBannerChange(ctx, tx, models.BannerUpdated, updated)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("couldn't commit banner update: %w", checkConflictErr(err))
+	}
 	return nil
 }
 
@@ -292,13 +459,11 @@ func (p *PGStorage) DeleteBanner(ctx context.Context, bannerId int) error {
 		return err
 	}
 
-	defer func() {
-		if err != nil {
-			tx.Rollback(ctx)
-		} else {
-			tx.Commit(ctx)
-		}
-	}()
+	defer tx.Rollback(ctx)
+	banner, err := getBannerById(ctx, tx, getBannerByIdForUpdateQuery, bannerId)
+	if err != nil {
+		return err
+	}
 	result, err := tx.Exec(ctx, deleteBannerTagsQuery, bannerId)
 	if err != nil {
 		return err
@@ -313,6 +478,100 @@ func (p *PGStorage) DeleteBanner(ctx context.Context, bannerId int) error {
 	if result.RowsAffected() == 0 {
 		return fmt.Errorf("banner with given id (%d): %w", bannerId, storage.ErrNotFound)
 	}
+	err = writeOutboxEvent(ctx, tx, models.BannerDeleted, banner)
+	if err != nil {
+		return err
+	}
+	err = writeAuditRecord(ctx, tx, models.AuditDelete, bannerId, banner, nil)
+	if err != nil {
+		return err
+	}
+	err = writeBannerChange(ctx, tx, models.BannerDeleted, banner)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("couldn't commit banner deletion: %w", err)
+	}
+	return nil
+}
+
+func writeBannerChange(ctx context.Context, tx pgx.Tx, event string, banner *models.Banner) error {
+	_, err := tx.Exec(
+		ctx,
+		insertBannerChangeQuery,
+		pgx.NamedArgs{
+			"event":      event,
+			"banner_id":  banner.Id,
+			"feature_id": banner.FeatureId,
+			"tag_ids":    banner.TagIds,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't insert banner change: %w", err)
+	}
+	return nil
+}
+
+// GetBannerChanges returns up to limit banner changes after the cursor, featureIds limits features if not nil.
+func (p *PGStorage) GetBannerChanges(ctx context.Context, after models.BannerChangeCursor, featureIds []int, limit int) ([]*models.BannerChange, error) {
+	rows, err := p.connection.Query(ctx, getBannerChangesQuery, pgx.NamedArgs{
+		"tx_id":       after.TxId,
+		"id":          after.Id,
+		"feature_ids": featureIds,
+		"limit":       limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get banner changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := make([]*models.BannerChange, 0, limit)
+	for rows.Next() {
+		change := &models.BannerChange{}
+		err = rows.Scan(&change.Id, &change.TxId, &change.Event, &change.BannerId, &change.FeatureId, &change.TagIds, &change.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan banner change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get banner changes: %w", err)
+	}
+	return changes, nil
+}
+
+func (p *PGStorage) GetLastBannerChangeCursor(ctx context.Context) (models.BannerChangeCursor, error) {
+	var cursor models.BannerChangeCursor
+	err := p.connection.QueryRow(ctx, getLastBannerChangeQuery).Scan(&cursor.TxId, &cursor.Id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return cursor, fmt.Errorf("couldn't get last banner change: %w", err)
+	}
+	return cursor, nil
+}
+
+// ReleaseBanners deletes all banners with their feature and tags relations.
+func (p *PGStorage) ReleaseBanners(ctx context.Context) error {
+	tx, err := p.connection.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			tx.Commit(ctx)
+		}
+	}()
+	_, err = tx.Exec(ctx, deleteAllBannerTagsQuery)
+	if err != nil {
+		return fmt.Errorf("couldn't delete banners tags: %w", err)
+	}
+	_, err = tx.Exec(ctx, deleteAllBannersQuery)
+	if err != nil {
+		return fmt.Errorf("couldn't delete banners: %w", err)
+	}
 	return nil
 }
 
@@ -332,3 +591,26 @@ func checkConflictErr(err error) error {
 func (p *PGStorage) Ping(ctx context.Context) error {
 	return p.connection.Ping(ctx)
 }
+
+// CheckMigrations returns error if database schema is older than SchemaVersion or the last migration failed.
+// Newer schema is accepted, migrations are applied before rollout of the code that needs them.
+func (p *PGStorage) CheckMigrations(ctx context.Context) error {
+	var (
+		version int
+		dirty   bool
+	)
+	err := p.connection.QueryRow(ctx, getMigrationVersionQuery).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("migrations are not applied, expected version %d", SchemaVersion)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't get migration version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if version < SchemaVersion {
+		return fmt.Errorf("migration version %d, expected %d", version, SchemaVersion)
+	}
+	return nil
+}
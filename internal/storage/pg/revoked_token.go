@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+var (
+	// insertRevokedTokenQuery keeps first revocation of the token.
+	insertRevokedTokenQuery = `insert into revoked_token(jti, expires_at, reason) values (@jti, @expires_at, @reason)
+		on conflict (jti) do nothing`
+
+	isTokenRevokedQuery = `select exists(select 1 from revoked_token where jti=$1)`
+
+	getRevokedTokensQuery = `select jti, expires_at, reason, revoked_at from revoked_token
+		where expires_at is NULL or expires_at > now()`
+)
+
+func (p *PGStorage) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	_, err := p.connection.Exec(
+		ctx,
+		insertRevokedTokenQuery,
+		pgx.NamedArgs{
+			"jti":        token.Jti,
+			"expires_at": token.ExpiresAt,
+			"reason":     token.Reason,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't insert revoked token: %w", err)
+	}
+	return nil
+}
+
+func (p *PGStorage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	if err := p.connection.QueryRow(ctx, isTokenRevokedQuery, jti).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("couldn't check revoked token: %w", err)
+	}
+	return revoked, nil
+}
+
+// GetRevokedTokens returns revoked tokens which are not expired yet.
+func (p *PGStorage) GetRevokedTokens(ctx context.Context) ([]*models.RevokedToken, error) {
+	rows, err := p.connection.Query(ctx, getRevokedTokensQuery)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get revoked tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []*models.RevokedToken{}
+	for rows.Next() {
+		token := &models.RevokedToken{}
+		if err = rows.Scan(&token.Jti, &token.ExpiresAt, &token.Reason, &token.RevokedAt); err != nil {
+			return nil, fmt.Errorf("couldn't scan revoked token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get revoked tokens: %w", err)
+	}
+	return tokens, nil
+}
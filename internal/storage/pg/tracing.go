@@ -0,0 +1,87 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/unbeman/av-banner-task/internal/logging"
+)
+
+var tracer = otel.Tracer("github.com/unbeman/av-banner-task/internal/storage/pg")
+
+// queryTracer creates span for each query and copy and logs queries on debug level, arguments are not recorded.
+type queryTracer struct{}
+
+type queryInfoKey struct{}
+
+// queryInfo is kept in context of the query for its log line.
+type queryInfo struct {
+	operation string
+	start     time.Time
+}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = tracer.Start(ctx, "pg "+queryOperation(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBQueryText(data.SQL)),
+	)
+	return context.WithValue(ctx, queryInfoKey{}, queryInfo{operation: queryOperation(data.SQL), start: time.Now()})
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.Err)
+	if !log.IsLevelEnabled(log.DebugLevel) {
+		return
+	}
+	// аргументы запросов могут содержать хэши ключей и контент баннеров, поэтому не пишутся
+	entry := logging.FromContext(ctx).WithField("rows", data.CommandTag.RowsAffected())
+	if info, ok := ctx.Value(queryInfoKey{}).(queryInfo); ok {
+		entry = entry.WithFields(log.Fields{
+			"operation":   info.operation,
+			"duration_ms": time.Since(info.start).Milliseconds(),
+		})
+	}
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		entry = entry.WithError(data.Err)
+	}
+	entry.Debug("sql query")
+}
+
+func (queryTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	ctx, _ = tracer.Start(ctx, "pg COPY",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, attribute.String("db.collection.name", data.TableName.Sanitize())),
+	)
+	return ctx
+}
+
+func (queryTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.Err)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // отсутствие строк - обычный результат
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryOperation returns SQL command of the query, e.g. SELECT, to name the span.
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
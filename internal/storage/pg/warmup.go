@@ -0,0 +1,40 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+// getActiveBannersQuery returns content of active banners for each feature and tag, recently updated first.
+var getActiveBannersQuery = `select bft.feature_id, bft.tag_id, b.content from "banner" as b
+		inner join "banner_feature_tags" bft on b.id = bft.banner_id
+		where b.is_active
+		order by b.updated_at desc
+		limit @limit`
+
+// StreamActiveBanners calls fn for each active banner row as it's read from database, so banners aren't loaded to memory at once.
+// Limit bounds count of rows if it's positive.
+func (p *PGStorage) StreamActiveBanners(ctx context.Context, limit int, fn func(banner storage.CachedBanner) error) error {
+	var limitArg *int
+	if limit > 0 {
+		limitArg = &limit
+	}
+	rows, err := p.connection.Query(ctx, getActiveBannersQuery, pgx.NamedArgs{"limit": limitArg})
+	if err != nil {
+		return fmt.Errorf("couldn't get active banners: %w", err)
+	}
+	defer rows.Close()
+
+	var banner storage.CachedBanner
+	_, err = pgx.ForEachRow(rows, []any{&banner.FeatureId, &banner.TagId, &banner.Content}, func() error {
+		return fn(banner)
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't stream active banners: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+var (
+	insertWebhookQuery = `insert into webhook(url, secret, events) values (@url, @secret, @events) returning id, created_at`
+
+	getWebhooksQuery = `select id, url, events, created_at from webhook order by id`
+
+	deleteWebhookQuery = `delete from webhook where id=$1`
+
+	getWebhookDeliveriesQuery = `select
+    d.id,
+    d.webhook_id,
+    d.outbox_id,
+    o.event,
+    o.banner_id,
+    d.status,
+    d.attempts,
+    d.response_code,
+    d.last_error,
+    d.next_attempt_at,
+    d.created_at,
+    d.delivered_at
+from webhook_delivery as d
+    inner join banner_outbox as o on o.id = d.outbox_id
+where d.webhook_id=@webhook_id and ((@status::varchar is NULL) or (d.status=@status))
+order by d.id desc
+limit @limit
+offset @offset`
+
+	dispatchWebhookEventsQuery = `with events as (
+    select id, event from banner_outbox
+    where webhooks_dispatched_at is NULL
+    order by id
+    limit $1
+    for update skip locked
+), deliveries as (
+    insert into webhook_delivery(webhook_id, outbox_id)
+    select w.id, e.id from events as e
+        inner join webhook as w on e.event = any(w.events)
+), dispatched as (
+    update banner_outbox set webhooks_dispatched_at=now() where id in (select id from events)
+)
+select count(*) from events`
+
+	// следующая попытка откладывается на время lease, чтобы другие диспетчеры пропускали отправляемые доставки
+	claimWebhookDeliveriesQuery = `update webhook_delivery as d
+set next_attempt_at=now() + $2 * interval '1 millisecond', attempts=d.attempts + 1
+from banner_outbox as o, webhook as w
+where d.id in (
+    select id from webhook_delivery
+    where status='pending' and next_attempt_at <= now()
+    order by next_attempt_at
+    limit $1
+    for update skip locked
+) and o.id = d.outbox_id and w.id = d.webhook_id
+returning d.id, d.webhook_id, d.outbox_id, o.event, o.banner_id, o.payload, o.created_at, d.attempts, d.created_at, w.url, w.secret`
+
+	updateWebhookDeliveryQuery = `update webhook_delivery
+set status=@status,
+    response_code=@response_code,
+    last_error=@last_error,
+    next_attempt_at=now() + @retry_in * interval '1 millisecond',
+    delivered_at=(case when @status='delivered' then now() end)
+where id=@id`
+)
+
+func (p *PGStorage) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	err := p.connection.QueryRow(
+		ctx,
+		insertWebhookQuery,
+		pgx.NamedArgs{
+			"url":    webhook.URL,
+			"secret": webhook.Secret,
+			"events": webhook.Events,
+		},
+	).Scan(&webhook.Id, &webhook.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't insert webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+func (p *PGStorage) GetWebhooks(ctx context.Context) (models.Webhooks, error) {
+	rows, err := p.connection.Query(ctx, getWebhooksQuery)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := models.Webhooks{}
+	for rows.Next() {
+		webhook := &models.Webhook{}
+		err = rows.Scan(&webhook.Id, &webhook.URL, &webhook.Events, &webhook.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (p *PGStorage) DeleteWebhook(ctx context.Context, webhookId int) error {
+	result, err := p.connection.Exec(ctx, deleteWebhookQuery, webhookId)
+	if err != nil {
+		return fmt.Errorf("couldn't delete webhook: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("webhook with given id (%d): %w", webhookId, storage.ErrNotFound)
+	}
+	return nil
+}
+
+func (p *PGStorage) GetWebhookDeliveries(ctx context.Context, webhookId int, status *string, limit *int, offset *int) (models.WebhookDeliveries, error) {
+	rows, err := p.connection.Query(
+		ctx,
+		getWebhookDeliveriesQuery,
+		pgx.NamedArgs{"webhook_id": webhookId, "status": status, "limit": limit, "offset": offset},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := models.WebhookDeliveries{}
+	for rows.Next() {
+		delivery := &models.WebhookDelivery{}
+		err = rows.Scan(
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.EventId,
+			&delivery.Event,
+			&delivery.BannerId,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.ResponseCode,
+			&delivery.LastError,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (p *PGStorage) DispatchWebhookEvents(ctx context.Context, limit int) (int, error) {
+	var count int
+	if err := p.connection.QueryRow(ctx, dispatchWebhookEventsQuery, limit).Scan(&count); err != nil {
+		return 0, fmt.Errorf("couldn't dispatch webhook events: %w", err)
+	}
+	return count, nil
+}
+
+func (p *PGStorage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (models.WebhookDeliveries, error) {
+	rows, err := p.connection.Query(ctx, claimWebhookDeliveriesQuery, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := models.WebhookDeliveries{}
+	for rows.Next() {
+		delivery := &models.WebhookDelivery{Status: models.DeliveryPending}
+		err = rows.Scan(
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.EventId,
+			&delivery.Event,
+			&delivery.BannerId,
+			&delivery.Payload,
+			&delivery.EventCreatedAt,
+			&delivery.Attempts,
+			&delivery.CreatedAt,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (p *PGStorage) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery, retryIn time.Duration) error {
+	_, err := p.connection.Exec(
+		ctx,
+		updateWebhookDeliveryQuery,
+		pgx.NamedArgs{
+			"id":            delivery.Id,
+			"status":        delivery.Status,
+			"response_code": delivery.ResponseCode,
+			"last_error":    delivery.LastError,
+			"retry_in":      retryIn.Milliseconds(),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't update webhook delivery: %w", err)
+	}
+	return nil
+}
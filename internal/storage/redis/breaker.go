@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+// Default setup of circuit breaker.
+const (
+	BreakerThresholdDefault = 5
+	BreakerCooldownDefault  = 10 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling Redis while the circuit breaker is open.
+var ErrCircuitOpen = fmt.Errorf("redis circuit breaker is open: %w", storage.ErrUnavailable)
+
+var (
+	breakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "redis_circuit_breaker_state",
+		Help: "State of Redis circuit breaker: 0 - closed, 1 - open, 2 - half-open.",
+	})
+	breakerOpened = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "redis_circuit_breaker_opened_total",
+		Help: "Count of times Redis circuit breaker was opened.",
+	})
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen // пропускается одна пробная команда
+)
+
+// circuitBreaker stops calls to Redis after threshold of consecutive failures for cooldown,
+// then lets one command through and closes if it succeeds.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	breakerState.Set(float64(circuitClosed))
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow returns ErrCircuitOpen if the call must not reach Redis.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(circuitHalfOpen)
+		return nil
+	case circuitHalfOpen:
+		return ErrCircuitOpen // ждем результата пробной команды
+	default:
+		return nil
+	}
+}
+
+// record updates state by result of the call allowed before.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Is(err, context.Canceled) {
+		// отмена вызывающим ничего не говорит о доступности Redis
+		if b.state == circuitHalfOpen {
+			// время открытия прежнее, поэтому следующая команда снова будет пробной
+			b.setState(circuitOpen)
+		}
+		return
+	}
+	if !isConnectionFailure(err) {
+		if b.state == circuitHalfOpen {
+			log.Info("redis is available again, circuit breaker is closed")
+			b.setState(circuitClosed)
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		if b.state == circuitClosed {
+			log.Warnf("redis circuit breaker is open for %s after %d failures: %v", b.cooldown, b.failures, err)
+			breakerOpened.Inc()
+		}
+		b.openedAt = b.now()
+		b.setState(circuitOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state circuitState) {
+	b.state = state
+	breakerState.Set(float64(state))
+}
+
+// isConnectionFailure reports whether error means Redis isn't available.
+// Errors replied by Redis, like absent key, mean it's alive.
+func isConnectionFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+// Hooks implement redis.Hook, commands are rejected while circuit is open.
+
+func (b *circuitBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *circuitBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := b.allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *circuitBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := b.allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
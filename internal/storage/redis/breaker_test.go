@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(2, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+	errDown := errors.New("dial tcp: connection refused")
+
+	// ответы Redis и отмена запроса клиентом не считаются отказами
+	for _, err := range []error{redis.Nil, context.Canceled, errDown, nil, errDown} {
+		assert.NoError(t, breaker.allow())
+		breaker.record(err)
+	}
+	assert.Equal(t, circuitClosed, breaker.state)
+
+	assert.NoError(t, breaker.allow())
+	breaker.record(errDown)
+	assert.Equal(t, circuitOpen, breaker.state)
+	assert.ErrorIs(t, breaker.allow(), ErrCircuitOpen)
+
+	// после паузы пропускается одна пробная команда
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, breaker.allow())
+	assert.ErrorIs(t, breaker.allow(), ErrCircuitOpen)
+	breaker.record(errDown)
+	assert.Equal(t, circuitOpen, breaker.state)
+	assert.ErrorIs(t, breaker.allow(), ErrCircuitOpen)
+
+	// отмененная пробная команда не закрывает и не продлевает паузу
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, breaker.allow())
+	breaker.record(context.Canceled)
+	assert.Equal(t, circuitOpen, breaker.state)
+
+	assert.NoError(t, breaker.allow())
+	breaker.record(nil)
+	assert.Equal(t, circuitClosed, breaker.state)
+	assert.NoError(t, breaker.allow())
+}
@@ -0,0 +1,33 @@
+package redis
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	poolHitsDesc       = prometheus.NewDesc("redis_pool_hits_total", "Count of times free connection was found in the pool.", nil, nil)
+	poolMissesDesc     = prometheus.NewDesc("redis_pool_misses_total", "Count of times free connection was not found in the pool.", nil, nil)
+	poolTimeoutsDesc   = prometheus.NewDesc("redis_pool_timeouts_total", "Count of times a wait timeout occurred.", nil, nil)
+	poolTotalConnsDesc = prometheus.NewDesc("redis_pool_total_conns", "Count of connections in the pool.", nil, nil)
+	poolIdleConnsDesc  = prometheus.NewDesc("redis_pool_idle_conns", "Count of idle connections in the pool.", nil, nil)
+	poolStaleConnsDesc = prometheus.NewDesc("redis_pool_stale_conns_total", "Count of stale connections removed from the pool.", nil, nil)
+)
+
+// Describe implements prometheus.Collector for connection pool stats.
+func (r RedisManager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolHitsDesc
+	ch <- poolMissesDesc
+	ch <- poolTimeoutsDesc
+	ch <- poolTotalConnsDesc
+	ch <- poolIdleConnsDesc
+	ch <- poolStaleConnsDesc
+}
+
+// Collect implements prometheus.Collector for connection pool stats.
+func (r RedisManager) Collect(ch chan<- prometheus.Metric) {
+	stats := r.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(poolHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(poolMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(poolTimeoutsDesc, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(poolTotalConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(poolIdleConnsDesc, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(poolStaleConnsDesc, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript takes a token from the bucket, time is taken from Redis to be the same for all replicas.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated_at')
+local tokens = tonumber(bucket[1]) or burst
+local updated_at = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated_at) * rate)
+
+local allowed = 0
+local retry_after = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    retry_after = (1 - tokens) / rate
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated_at', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(retry_after)}
+`)
+
+// RateLimiter keeps token buckets in Redis, limits are shared by all service replicas.
+type RateLimiter struct {
+	client *redis.Client
+}
+
+func NewRateLimiter(manager *RedisManager) *RateLimiter {
+	return &RateLimiter{client: manager.client}
+}
+
+func rateLimitKey(key string) string {
+	return "rate_limit:" + key
+}
+
+func (l RateLimiter) Allow(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	result, err := tokenBucketScript.Run(ctx, l.client, []string{rateLimitKey(key)}, rate, burst).Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("can't exec redis rate limit script: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected redis rate limit script result: %v", result)
+	}
+	allowed, _ := result[0].(int64)
+	retryAfterText, _ := result[1].(string)
+	retryAfter, err := strconv.ParseFloat(retryAfterText, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("unexpected redis rate limit script result: %w", err)
+	}
+	return allowed == 1, time.Duration(retryAfter * float64(time.Second)), nil
+}
@@ -13,35 +13,88 @@ import (
 )
 
 type RedisManager struct {
-	client     *redis.Client
-	expiration time.Duration
+	client          *redis.Client
+	expiration      time.Duration
+	staleExpiration time.Duration
+	breaker         *circuitBreaker
 }
 
-func NewRedisManager(redisURL string, expiration time.Duration) (*RedisManager, error) {
+// StaleExpirationDefault is a default lifetime of last known good copies of banners.
+const StaleExpirationDefault = 24 * time.Hour
+
+type RedisManagerOption func(r *RedisManager)
+
+// WithCircuitBreaker sets count of consecutive failures opening the circuit breaker
+// and time before it lets a command through to check Redis again.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) RedisManagerOption {
+	return func(r *RedisManager) {
+		r.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// WithStaleExpiration sets lifetime of last known good copies of banners.
+func WithStaleExpiration(expiration time.Duration) RedisManagerOption {
+	return func(r *RedisManager) {
+		r.staleExpiration = expiration
+	}
+}
+
+func NewRedisManager(redisURL string, expiration time.Duration, opts ...RedisManagerOption) (*RedisManager, error) {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, err
 	}
-	client := redis.NewClient(opt)
-	return &RedisManager{
-		client:     client,
-		expiration: expiration,
-	}, nil
+	manager := &RedisManager{
+		client:          redis.NewClient(opt),
+		expiration:      expiration,
+		staleExpiration: StaleExpirationDefault,
+		breaker:         newCircuitBreaker(BreakerThresholdDefault, BreakerCooldownDefault),
+	}
+	for _, o := range opts {
+		o(manager)
+	}
+	manager.client.AddHook(tracingHook{})
+	manager.client.AddHook(manager.breaker)
+	return manager, nil
+}
+
+func bannerKey(featureId, tagId int) string {
+	return fmt.Sprintf("%d-%d", featureId, tagId)
+}
 
+func staleBannerKey(featureId, tagId int) string {
+	return "stale:" + bannerKey(featureId, tagId)
 }
 
+// SetBanner caches banner content with its last known good copy in one pipeline.
 func (r RedisManager) SetBanner(ctx context.Context, featureId, tagId int, bannerContent *string) error {
-	key := fmt.Sprintf("%d-%d", featureId, tagId)
-	err := r.client.Set(ctx, key, bannerContent, r.expiration).Err()
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, bannerKey(featureId, tagId), bannerContent, r.expiration)
+		pipe.Set(ctx, staleBannerKey(featureId, tagId), bannerContent, r.staleExpiration)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("can't exec redis set command: %w", err)
+		return fmt.Errorf("can't exec redis set pipeline: %w", err)
 	}
 	return nil
 }
 
 func (r RedisManager) GetBanner(ctx context.Context, featureId, tagId int) (*string, error) {
 	var bannerContent string
-	key := fmt.Sprintf("%d-%d", featureId, tagId)
+	key := bannerKey(featureId, tagId)
+	bannerContent, err := r.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("no banner with key (%s): %w", key, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't exec redis get command: %w", err)
+	}
+	return &bannerContent, nil
+}
+
+// GetStaleBanner returns last known good copy of banner content, which outlives the cached one.
+func (r RedisManager) GetStaleBanner(ctx context.Context, featureId, tagId int) (*string, error) {
+	key := staleBannerKey(featureId, tagId)
 	bannerContent, err := r.client.Get(ctx, key).Result()
 	if errors.Is(err, redis.Nil) {
 		return nil, fmt.Errorf("no banner with key (%s): %w", key, storage.ErrNotFound)
@@ -52,6 +105,101 @@ func (r RedisManager) GetBanner(ctx context.Context, featureId, tagId int) (*str
 	return &bannerContent, nil
 }
 
+// GetBannersByFeatures returns cached banners content for given features and tag in one MGET call.
+// Features without cached banner are absent in the result.
+func (r RedisManager) GetBannersByFeatures(ctx context.Context, featureIds []int, tagId int) (map[int]string, error) {
+	keys := make([]string, len(featureIds))
+	for i, featureId := range featureIds {
+		keys[i] = bannerKey(featureId, tagId)
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("can't exec redis mget command: %w", err)
+	}
+
+	bannersContent := make(map[int]string, len(values))
+	for i, value := range values {
+		content, ok := value.(string)
+		if !ok { // для отсутствующих ключей MGET возвращает nil
+			continue
+		}
+		bannersContent[featureIds[i]] = content
+	}
+	return bannersContent, nil
+}
+
+// SetBannersByFeatures caches banners content with last known good copies for given tag using pipelined SET commands.
+func (r RedisManager) SetBannersByFeatures(ctx context.Context, tagId int, bannersContent map[int]string) error {
+	if len(bannersContent) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for featureId, content := range bannersContent {
+			pipe.Set(ctx, bannerKey(featureId, tagId), content, r.expiration)
+			pipe.Set(ctx, staleBannerKey(featureId, tagId), content, r.staleExpiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't exec redis set pipeline: %w", err)
+	}
+	return nil
+}
+
+// SetBanners caches banners content with last known good copies using pipelined SET commands.
+func (r RedisManager) SetBanners(ctx context.Context, banners []storage.CachedBanner) error {
+	if len(banners) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, banner := range banners {
+			pipe.Set(ctx, bannerKey(banner.FeatureId, banner.TagId), banner.Content, r.expiration)
+			pipe.Set(ctx, staleBannerKey(banner.FeatureId, banner.TagId), banner.Content, r.staleExpiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't exec redis set pipeline: %w", err)
+	}
+	return nil
+}
+
+// DeleteBanners removes cached banners of feature and given tags with their last known good copies in one DEL call.
+func (r RedisManager) DeleteBanners(ctx context.Context, featureId int, tagIds []int) error {
+	if len(tagIds) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, 2*len(tagIds))
+	for _, tagId := range tagIds {
+		keys = append(keys, bannerKey(featureId, tagId), staleBannerKey(featureId, tagId))
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("can't exec redis del command: %w", err)
+	}
+	return nil
+}
+
+func revokedTokenKey(jti string) string {
+	return "revoked_token:" + jti
+}
+
+func (r RedisManager) SetRevokedToken(ctx context.Context, jti string, expiration time.Duration) error {
+	err := r.client.Set(ctx, revokedTokenKey(jti), 1, expiration).Err()
+	if err != nil {
+		return fmt.Errorf("can't exec redis set command: %w", err)
+	}
+	return nil
+}
+
+func (r RedisManager) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := r.client.Exists(ctx, revokedTokenKey(jti)).Result()
+	if err != nil {
+		return false, fmt.Errorf("can't exec redis exists command: %w", err)
+	}
+	return count > 0, nil
+}
+
 func (r RedisManager) Ping(ctx context.Context) error {
 	status := r.client.Ping(ctx)
 	return status.Err()
@@ -61,7 +209,10 @@ func (r RedisManager) Clear(ctx context.Context) {
 	r.client.FlushAll(ctx)
 }
 
-func (r RedisManager) Shutdown() {
-	r.client.Close()
+func (r RedisManager) Shutdown() error {
+	if err := r.client.Close(); err != nil {
+		return fmt.Errorf("couldn't close redis client: %w", err)
+	}
 	log.Info("redis client closed")
+	return nil
 }
@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+// WebhookOutbox is used by webhook dispatcher to deliver banner events from outbox.
+type WebhookOutbox interface {
+	DispatchWebhookEvents(ctx context.Context, limit int) (int, error)
+	// ClaimWebhookDeliveries returns due deliveries and hides them from other claims for lease duration.
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (models.WebhookDeliveries, error)
+	// UpdateWebhookDelivery saves delivery attempt result, pending delivery is retried after retryIn.
+	UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery, retryIn time.Duration) error
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	apiKeyPrefix      = "bk_"
+	apiKeyBytes       = 32
+	apiKeyShownPrefix = len(apiKeyPrefix) + 8
+)
+
+// GenerateAPIKey returns new random API key and its prefix to identify the key in lists.
+func GenerateAPIKey() (key string, prefix string, err error) {
+	data := make([]byte, apiKeyBytes)
+	if _, err = rand.Read(data); err != nil {
+		return "", "", fmt.Errorf("couldn't generate API key: %w", err)
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(data)
+	return key, key[:apiKeyShownPrefix], nil
+}
+
+// HashAPIKey returns hash of API key to store and look up the key.
+// Keys are random with enough entropy, so slow password hashes are not needed.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultCertificateWatchInterval is how often certificate files are checked for changes by default.
+const DefaultCertificateWatchInterval = 10 * time.Second
+
+// CertificateReloader serves TLS certificate from files and reloads it when files change,
+// so renewed certificate is used without restart.
+type CertificateReloader struct {
+	certFile      string
+	keyFile       string
+	watchInterval time.Duration
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time // время изменения файлов сертификата и ключа
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewCertificateReloader loads certificate and key pair from PEM files.
+func NewCertificateReloader(certFile, keyFile string, watchInterval time.Duration) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		watchInterval: watchInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads certificate from files, previous certificate is kept on error.
+func (r *CertificateReloader) Reload() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("couldn't load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *CertificateReloader) fileModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, fmt.Errorf("couldn't check TLS certificate file: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// GetCertificate returns current certificate, it's used as tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Run reloads certificate on change of its files until Stop is called.
+func (r *CertificateReloader) Run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			modTimes, err := r.fileModTimes()
+			if err != nil {
+				log.Errorf("couldn't check TLS certificate, previous certificate is kept: %v", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := modTimes != r.modTimes
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			// сертификат и ключ могут обновляться не одновременно, тогда пара не загрузится до записи второго файла
+			if err = r.Reload(); err != nil {
+				log.Errorf("couldn't reload TLS certificate, previous certificate is kept: %v", err)
+				continue
+			}
+			log.Info("TLS certificate reloaded")
+		}
+	}
+}
+
+// Stop stops certificate watching.
+func (r *CertificateReloader) Stop() {
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate writes self-signed certificate with given common name and its key, files get given modification time.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func commonName(t *testing.T, reloader *CertificateReloader) string {
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Minute)
+	writeCertificate(t, certFile, keyFile, "first", modTime)
+
+	_, err := NewCertificateReloader(certFile, filepath.Join(dir, "absent.pem"), time.Second)
+	require.Error(t, err)
+
+	reloader, err := NewCertificateReloader(certFile, keyFile, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, reloader))
+	go reloader.Run()
+	defer reloader.Stop()
+
+	// некорректный файл не заменяет действующий сертификат
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0600))
+	require.Error(t, reloader.Reload())
+	assert.Equal(t, "first", commonName(t, reloader))
+
+	writeCertificate(t, certFile, keyFile, "second", modTime.Add(time.Second))
+	assert.Eventually(t, func() bool { return commonName(t, reloader) == "second" }, time.Second, 10*time.Millisecond)
+}
@@ -1,42 +1,341 @@
 package utils
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
 	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
 	ErrInvalidToken = errors.New("invalid token")
+
+	ErrTokenExpired          = errors.New("token is expired")
+	ErrTokenNotValidYet      = errors.New("token is not valid yet")
+	ErrTokenUsedBeforeIssued = errors.New("token used before issued")
+	ErrTokenNoExpiration     = errors.New("token has no expiration")
+	ErrTokenInvalidIssuer    = errors.New("token has invalid issuer")
+	ErrTokenInvalidAudience  = errors.New("token has invalid audience")
 )
 
+// Default values of token validation.
+const (
+	DefaultClockSkew           = 30 * time.Second
+	DefaultTokenTTL            = time.Hour
+	DefaultKeysRefreshInterval = 5 * time.Minute
+	DefaultKeysWatchInterval   = 10 * time.Second
+)
+
+const keysLoadTimeout = 10 * time.Second
+
 type JWTManager struct {
-	privateKey []byte
+	signingKeysFile   string // файл с набором ключей HS256, отслеживается на изменения
+	keysWatchInterval time.Duration
+
+	keySources          []KeySource
+	keysRefreshInterval time.Duration
+
+	keysMu             sync.RWMutex
+	signingKeys        map[string][]byte           // ключи для HS256 по kid, если пусто, то такие токены не принимаются
+	currentKid         string                      // kid ключа для подписи новых токенов
+	publicKeys         map[string]crypto.PublicKey // ключи для RS256/ES256 по kid
+	signingKeysModTime time.Time
+
+	stop chan struct{}
+	done chan struct{}
+
+	issuer    string // если задан, то токен должен содержать такой же iss
+	audience  string // если задан, то токен должен содержать такой же aud
+	clockSkew time.Duration
+	tokenTTL  time.Duration
+
+	now func() time.Time
+}
+
+type JWTOption func(m *JWTManager)
+
+// WithIssuer makes iss claim required and equal to given issuer.
+func WithIssuer(issuer string) JWTOption {
+	return func(m *JWTManager) {
+		m.issuer = issuer
+	}
+}
+
+// WithAudience makes aud claim required and equal to given audience.
+func WithAudience(audience string) JWTOption {
+	return func(m *JWTManager) {
+		m.audience = audience
+	}
+}
+
+// WithClockSkew sets allowed difference of clocks between token issuer and the service.
+func WithClockSkew(skew time.Duration) JWTOption {
+	return func(m *JWTManager) {
+		m.clockSkew = skew
+	}
+}
+
+// WithTokenTTL sets lifetime of tokens created by Generate.
+func WithTokenTTL(ttl time.Duration) JWTOption {
+	return func(m *JWTManager) {
+		m.tokenTTL = ttl
+	}
+}
+
+// WithKeySources enables verification of RSA and ECDSA signed tokens with public keys from given sources.
+func WithKeySources(sources ...KeySource) JWTOption {
+	return func(m *JWTManager) {
+		m.keySources = append(m.keySources, sources...)
+	}
+}
+
+// WithKeysRefreshInterval sets how often public keys are reloaded from sources.
+func WithKeysRefreshInterval(interval time.Duration) JWTOption {
+	return func(m *JWTManager) {
+		m.keysRefreshInterval = interval
+	}
+}
+
+// WithSigningKeysFile replaces private key with key set loaded from file, see SigningKeySet.
+func WithSigningKeysFile(path string) JWTOption {
+	return func(m *JWTManager) {
+		m.signingKeysFile = path
+	}
+}
+
+// WithKeysWatchInterval sets how often signing keys file is checked for changes.
+func WithKeysWatchInterval(interval time.Duration) JWTOption {
+	return func(m *JWTManager) {
+		m.keysWatchInterval = interval
+	}
+}
+
+// NewJWTManager creates manager signing tokens with privateKey. Tokens signed with privateKey have no kid,
+// with WithSigningKeysFile the private key is ignored.
+func NewJWTManager(privateKey string, opts ...JWTOption) (*JWTManager, error) {
+	m := &JWTManager{
+		signingKeys:         make(map[string][]byte),
+		keysRefreshInterval: DefaultKeysRefreshInterval,
+		keysWatchInterval:   DefaultKeysWatchInterval,
+		publicKeys:          make(map[string]crypto.PublicKey),
+		clockSkew:           DefaultClockSkew,
+		tokenTTL:            DefaultTokenTTL,
+		now:                 time.Now,
+		stop:                make(chan struct{}),
+		done:                make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.signingKeysFile != "" {
+		if err := m.ReloadSigningKeys(); err != nil {
+			return nil, err
+		}
+	} else if privateKey != "" {
+		m.signingKeys[""] = []byte(privateKey)
+	}
+
+	if len(m.keySources) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), keysLoadTimeout)
+		defer cancel()
+		if err := m.RefreshKeys(ctx); err != nil {
+			return nil, fmt.Errorf("couldn't load public keys: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// RefreshKeys reloads public keys from all sources. Keys are replaced only if every source is loaded.
+func (m *JWTManager) RefreshKeys(ctx context.Context) error {
+	keys := make(map[string]crypto.PublicKey)
+	for _, source := range m.keySources {
+		sourceKeys, err := source.Load(ctx)
+		if err != nil {
+			return err
+		}
+		for kid, key := range sourceKeys {
+			keys[kid] = key
+		}
+	}
+
+	m.keysMu.Lock()
+	m.publicKeys = keys
+	m.keysMu.Unlock()
+	return nil
+}
+
+// SetSigningKeys replaces HS256 keys, tokens signed with keys missing in the set are no longer accepted.
+func (m *JWTManager) SetSigningKeys(set *SigningKeySet) error {
+	if err := set.Validate(); err != nil {
+		return fmt.Errorf("invalid signing keys: %w", err)
+	}
+	m.keysMu.Lock()
+	m.signingKeys = set.secrets()
+	m.currentKid = set.CurrentKid
+	m.keysMu.Unlock()
+	return nil
+}
+
+// ReloadSigningKeys loads HS256 keys from signing keys file if it is set. Keys are kept on error.
+func (m *JWTManager) ReloadSigningKeys() error {
+	if m.signingKeysFile == "" {
+		return nil
+	}
+	info, err := os.Stat(m.signingKeysFile)
+	if err != nil {
+		return fmt.Errorf("couldn't read signing keys file: %w", err)
+	}
+	set, err := LoadSigningKeySet(m.signingKeysFile)
+	if err != nil {
+		return err
+	}
+	if err = m.SetSigningKeys(set); err != nil {
+		return err
+	}
+	m.keysMu.Lock()
+	m.signingKeysModTime = info.ModTime()
+	m.keysMu.Unlock()
+	log.Infof("loaded %d signing keys, current kid %q", len(set.Keys), set.CurrentKid)
+	return nil
+}
+
+// ReloadKeys reloads both signing and public keys, it is used on SIGHUP.
+func (m *JWTManager) ReloadKeys(ctx context.Context) error {
+	if err := m.ReloadSigningKeys(); err != nil {
+		return err
+	}
+	if len(m.keySources) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, keysLoadTimeout)
+		defer cancel()
+		if err := m.RefreshKeys(ctx); err != nil {
+			return fmt.Errorf("couldn't load public keys: %w", err)
+		}
+	}
+	return nil
+}
+
+// RunKeysRefresh periodically reloads public keys and signing keys file on its change until Stop is called.
+func (m *JWTManager) RunKeysRefresh() {
+	defer close(m.done)
+
+	// nil каналы никогда не срабатывают, поэтому выключенные проверки просто не тикают
+	var refresh, watch <-chan time.Time
+	if len(m.keySources) > 0 {
+		ticker := time.NewTicker(m.keysRefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+	if m.signingKeysFile != "" {
+		ticker := time.NewTicker(m.keysWatchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+	if refresh == nil && watch == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-refresh:
+			ctx, cancel := context.WithTimeout(context.Background(), keysLoadTimeout)
+			if err := m.RefreshKeys(ctx); err != nil {
+				log.Errorf("couldn't refresh public keys, previous keys are kept: %v", err)
+			}
+			cancel()
+		case <-watch:
+			info, err := os.Stat(m.signingKeysFile)
+			if err != nil {
+				log.Errorf("couldn't check signing keys file: %v", err)
+				continue
+			}
+			m.keysMu.RLock()
+			changed := !info.ModTime().Equal(m.signingKeysModTime)
+			m.keysMu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err = m.ReloadSigningKeys(); err != nil {
+				log.Errorf("couldn't reload signing keys, previous keys are kept: %v", err)
+			}
+		}
+	}
+}
+
+// Stop stops keys refreshing.
+func (m *JWTManager) Stop() {
+	close(m.stop)
+	<-m.done
 }
 
-func NewJWTManager(privateKey string) (*JWTManager, error) {
-	return &JWTManager{privateKey: []byte(privateKey)}, nil
+// Audience is aud claim, which is either a string or an array of strings according to RFC 7519.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("aud should be a string or an array of strings: %w", err)
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Contains reports whether audience includes given value.
+func (a Audience) Contains(audience string) bool {
+	return slices.Contains(a, audience)
 }
 
 type UserClaims struct {
 	jwt.StandardClaims
-	UserRole int `json:"user_role"`
+	Audience Audience `json:"aud,omitempty"` // заменяет строковый aud из StandardClaims
+	Role     string   `json:"role,omitempty"`
+	Features []int    `json:"features"`            // фичи, баннерами которых можно управлять, без features и teams - любые
+	Teams    []string `json:"teams"`               // команды, фичи которых можно менять
+	UserRole *int     `json:"user_role,omitempty"` // устаревшая числовая роль: 0 - админ, 1 - пользователь
 }
 
-func (u UserClaims) Valid() error {
-	return nil
+// Expiration returns token expiration time, nil if token has no exp.
+func (c *UserClaims) Expiration() *time.Time {
+	if c.ExpiresAt == 0 {
+		return nil
+	}
+	expiration := time.Unix(c.ExpiresAt, 0)
+	return &expiration
 }
 
 func (m *JWTManager) Verify(accessToken string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(
+	// стандартная проверка claims не учитывает расхождение часов, поэтому проверяем их сами
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(
 		accessToken,
 		&UserClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected token signing method")
-			}
-			return m.privateKey, nil
-		},
+		m.verificationKey,
 	)
 
 	if err != nil {
@@ -48,16 +347,170 @@ func (m *JWTManager) Verify(accessToken string) (*UserClaims, error) {
 		return nil, fmt.Errorf("couldn't get user claims: %w", ErrInvalidToken)
 	}
 
+	if err = m.validateClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", err, ErrInvalidToken)
+	}
+
 	return claims, nil
 }
 
-func (m *JWTManager) Generate(role int) (string, error) {
-	claims := UserClaims{
-		UserRole: role,
+// verificationKey returns key to check token signature according to signing method and kid header.
+func (m *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return m.signingKey(token)
+	case *jwt.SigningMethodRSA:
+		key, err := m.publicKey(token)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("key is not RSA public key")
+		}
+		return key, nil
+	case *jwt.SigningMethodECDSA:
+		key, err := m.publicKey(token)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := key.(*ecdsa.PublicKey); !ok {
+			return nil, fmt.Errorf("key is not ECDSA public key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unexpected token signing method")
+	}
+}
+
+// signingKey returns HS256 key by token kid, token without kid is accepted only if there is a single key.
+func (m *JWTManager) signingKey(token *jwt.Token) ([]byte, error) {
+	m.keysMu.RLock()
+	defer m.keysMu.RUnlock()
+
+	if len(m.signingKeys) == 0 {
+		return nil, fmt.Errorf("HMAC signed tokens are not accepted")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(m.signingKeys) == 1 {
+		for _, key := range m.signingKeys {
+			return key, nil
+		}
+	}
+
+	key, ok := m.signingKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+// publicKey returns public key by token kid, token without kid is accepted only if there is a single key.
+func (m *JWTManager) publicKey(token *jwt.Token) (crypto.PublicKey, error) {
+	m.keysMu.RLock()
+	defer m.keysMu.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if len(m.publicKeys) != 1 {
+			return nil, fmt.Errorf("token has no kid")
+		}
+		for _, key := range m.publicKeys {
+			return key, nil
+		}
+	}
+
+	key, ok := m.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func (m *JWTManager) validateClaims(claims *UserClaims) error {
+	now := m.now()
+	skew := int64(m.clockSkew / time.Second)
+
+	if claims.ExpiresAt == 0 {
+		return ErrTokenNoExpiration
 	}
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.privateKey)
+	if now.Unix() > claims.ExpiresAt+skew {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Unix()+skew < claims.NotBefore {
+		return ErrTokenNotValidYet
+	}
+	if claims.IssuedAt != 0 && now.Unix()+skew < claims.IssuedAt {
+		return ErrTokenUsedBeforeIssued
+	}
+	if m.issuer != "" && claims.Issuer != m.issuer {
+		return ErrTokenInvalidIssuer
+	}
+	if m.audience != "" && !claims.Audience.Contains(m.audience) {
+		return ErrTokenInvalidAudience
+	}
+	return nil
+}
+
+// TokenTTL returns default lifetime of generated tokens.
+func (m *JWTManager) TokenTTL() time.Duration {
+	return m.tokenTTL
+}
+
+// Generate creates token with given role and lifetime set for the manager.
+func (m *JWTManager) Generate(role string) (string, error) {
+	return m.GenerateWithTTL(role, m.tokenTTL)
+}
+
+// GenerateWithTTL creates token with given role valid for ttl since now.
+func (m *JWTManager) GenerateWithTTL(role string, ttl time.Duration) (string, error) {
+	return m.GenerateWithClaims(UserClaims{Role: role}, ttl)
+}
+
+// GenerateWithClaims creates token with given user claims valid for ttl since now, signed with the current key.
+// Standard claims except subject are set by the manager.
+func (m *JWTManager) GenerateWithClaims(claims UserClaims, ttl time.Duration) (string, error) {
+	m.keysMu.RLock()
+	kid, key := m.currentKid, m.signingKeys[m.currentKid]
+	m.keysMu.RUnlock()
+	if len(key) == 0 {
+		return "", fmt.Errorf("could not create signed token: no signing key")
+	}
+
+	jti, err := newTokenId()
 	if err != nil {
 		return "", fmt.Errorf("could not create signed token: %w", err)
 	}
-	return token, nil
+
+	now := m.now()
+	claims.StandardClaims = jwt.StandardClaims{
+		Id:        jti,
+		Subject:   claims.Subject,
+		Issuer:    m.issuer,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+	claims.Audience = nil
+	if m.audience != "" {
+		claims.Audience = Audience{m.audience}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("could not create signed token: %w", err)
+	}
+	return signed, nil
+}
+
+// newTokenId returns random jti claim to revoke the token.
+func newTokenId() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("couldn't generate token id: %w", err)
+	}
+	return hex.EncodeToString(data), nil
 }
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "test-secret-key"
+
+var testNow = time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestManager(t *testing.T, opts ...JWTOption) *JWTManager {
+	m, err := NewJWTManager(testKey, opts...)
+	require.NoError(t, err)
+	m.now = func() time.Time { return testNow }
+	return m
+}
+
+func signHS256(t *testing.T, claims jwt.Claims, key string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	require.NoError(t, err)
+	return token
+}
+
+func validClaims() UserClaims {
+	return UserClaims{
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  testNow.Add(-time.Minute).Unix(),
+			NotBefore: testNow.Add(-time.Minute).Unix(),
+			ExpiresAt: testNow.Add(time.Hour).Unix(),
+		},
+		Role: "user",
+	}
+}
+
+func TestJWTManagerVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaToken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims()).SignedString(rsaKey)
+	require.NoError(t, err)
+
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		opts        []JWTOption
+		token       func() string
+		expectedErr error
+	}{
+		{
+			name:  "valid token",
+			token: func() string { return signHS256(t, validClaims(), testKey) },
+		},
+		{
+			name:        "empty token",
+			token:       func() string { return "" },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name:        "malformed token",
+			token:       func() string { return "not.a.token" },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name:        "wrong signature",
+			token:       func() string { return signHS256(t, validClaims(), "another-key") },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name:        "unexpected signing method",
+			token:       func() string { return rsaToken },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name:        "none signing method",
+			token:       func() string { return noneToken },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name: "no expiration",
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = 0
+				return signHS256(t, claims, testKey)
+			},
+			expectedErr: ErrTokenNoExpiration,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = testNow.Add(-time.Minute).Unix()
+				return signHS256(t, claims, testKey)
+			},
+			expectedErr: ErrTokenExpired,
+		},
+		{
+			name: "expired within clock skew",
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = testNow.Add(-10 * time.Second).Unix()
+				return signHS256(t, claims, testKey)
+			},
+		},
+		{
+			name: "expired beyond custom clock skew",
+			opts: []JWTOption{WithClockSkew(5 * time.Second)},
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = testNow.Add(-10 * time.Second).Unix()
+				return signHS256(t, claims, testKey)
+			},
+			expectedErr: ErrTokenExpired,
+		},
+		{
+			name: "not valid yet",
+			token: func() string {
+				claims := validClaims()
+				claims.NotBefore = testNow.Add(time.Minute).Unix()
+				return signHS256(t, claims, testKey)
+			},
+			expectedErr: ErrTokenNotValidYet,
+		},
+		{
+			name: "used before issued",
+			token: func() string {
+				claims := validClaims()
+				claims.IssuedAt = testNow.Add(time.Minute).Unix()
+				return signHS256(t, claims, testKey)
+			},
+			expectedErr: ErrTokenUsedBeforeIssued,
+		},
+		{
+			name: "missing required issuer",
+			opts: []JWTOption{WithIssuer("banner-auth")},
+			token: func() string {
+				return signHS256(t, validClaims(), testKey)
+			},
+			expectedErr: ErrTokenInvalidIssuer,
+		},
+		{
+			name: "wrong issuer",
+			opts: []JWTOption{WithIssuer("banner-auth")},
+			token: func() string {
+				claims := validClaims()
+				claims.Issuer = "someone-else"
+				return signHS256(t, claims, testKey)
+			},
+			expectedErr: ErrTokenInvalidIssuer,
+		},
+		{
+			name: "wrong audience",
+			opts: []JWTOption{WithAudience("banner-service")},
+			token: func() string {
+				claims := validClaims()
+				claims.Audience = Audience{"another-service"}
+				return signHS256(t, claims, testKey)
+			},
+			expectedErr: ErrTokenInvalidAudience,
+		},
+		{
+			name: "required issuer and audience",
+			opts: []JWTOption{WithIssuer("banner-auth"), WithAudience("banner-service")},
+			token: func() string {
+				claims := validClaims()
+				claims.Issuer = "banner-auth"
+				claims.Audience = Audience{"banner-service"}
+				return signHS256(t, claims, testKey)
+			},
+		},
+		{
+			name: "audience array",
+			opts: []JWTOption{WithAudience("banner-service")},
+			token: func() string {
+				return signHS256(t, jwt.MapClaims{
+					"exp":  testNow.Add(time.Hour).Unix(),
+					"aud":  []string{"another-service", "banner-service"},
+					"role": "user",
+				}, testKey)
+			},
+		},
+		{
+			name: "audience array without required audience",
+			opts: []JWTOption{WithAudience("banner-service")},
+			token: func() string {
+				return signHS256(t, jwt.MapClaims{
+					"exp":  testNow.Add(time.Hour).Unix(),
+					"aud":  []string{"another-service"},
+					"role": "user",
+				}, testKey)
+			},
+			expectedErr: ErrTokenInvalidAudience,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestManager(t, test.opts...)
+			claims, err := m.Verify(test.token())
+			if test.expectedErr == nil {
+				require.NoError(t, err)
+				assert.Equal(t, "user", claims.Role)
+				return
+			}
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+			assert.Nil(t, claims)
+		})
+	}
+}
+
+func TestJWTManagerGenerate(t *testing.T) {
+	m := newTestManager(t, WithIssuer("banner-auth"), WithAudience("banner-service"), WithTokenTTL(time.Minute))
+
+	token, err := m.Generate("owner")
+	require.NoError(t, err)
+	claims, err := m.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, testNow.Add(time.Minute).Unix(), claims.ExpiresAt)
+	assert.Equal(t, "banner-auth", claims.Issuer)
+	assert.Equal(t, Audience{"banner-service"}, claims.Audience)
+	assert.Len(t, claims.Id, 32)
+
+	// у каждого токена свой jti для отзыва
+	other, err := m.Generate("owner")
+	require.NoError(t, err)
+	otherClaims, err := m.Verify(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, claims.Id, otherClaims.Id)
+
+	token, err = m.GenerateWithTTL("owner", 10*time.Minute)
+	require.NoError(t, err)
+
+	m.now = func() time.Time { return testNow.Add(5 * time.Minute) }
+	_, err = m.Verify(token)
+	require.NoError(t, err)
+
+	m.now = func() time.Time { return testNow.Add(11 * time.Minute) }
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
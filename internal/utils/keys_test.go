@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer is a local stand-in for identity provider serving JWKS document.
+type jwksServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys []jwk
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(jwks{Keys: s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) setKeys(keys ...jwk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jwk {
+	return jwk{Kty: "RSA", Kid: kid, Use: "sig", N: encodeBigInt(key.N), E: encodeBigInt(big.NewInt(int64(key.E)))}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jwk {
+	return jwk{Kty: "EC", Kid: kid, Use: "sig", Crv: "P-256", X: encodeBigInt(key.X), Y: encodeBigInt(key.Y)}
+}
+
+func signWithKid(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, validClaims())
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestJWTManagerVerifyWithJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := newJWKSServer(t)
+	server.setKeys(rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+
+	m := newTestManager(t, WithKeySources(NewJWKSSource(server.URL, server.Client())))
+
+	tests := []struct {
+		name    string
+		token   string
+		invalid bool
+	}{
+		{name: "RS256 with kid", token: signWithKid(t, jwt.SigningMethodRS256, "rsa-1", rsaKey)},
+		{name: "ES256 with kid", token: signWithKid(t, jwt.SigningMethodES256, "ec-1", ecKey)},
+		{name: "HS256 is still accepted", token: signHS256(t, validClaims(), testKey)},
+		{name: "unknown kid", token: signWithKid(t, jwt.SigningMethodRS256, "rsa-2", rsaKey), invalid: true},
+		{name: "no kid with several keys", token: signWithKid(t, jwt.SigningMethodRS256, "", rsaKey), invalid: true},
+		{name: "wrong key for kid", token: signWithKid(t, jwt.SigningMethodRS256, "rsa-1", otherRSAKey), invalid: true},
+		{name: "RS256 with EC key kid", token: signWithKid(t, jwt.SigningMethodRS256, "ec-1", rsaKey), invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := m.Verify(test.token)
+			if test.invalid {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user", claims.Role)
+		})
+	}
+}
+
+func TestJWTManagerRefreshKeys(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := newJWKSServer(t)
+	server.setKeys(rsaJWK("old", &oldKey.PublicKey))
+
+	m := newTestManager(t, WithKeySources(NewJWKSSource(server.URL, server.Client())))
+
+	oldToken := signWithKid(t, jwt.SigningMethodRS256, "old", oldKey)
+	newToken := signWithKid(t, jwt.SigningMethodRS256, "new", newKey)
+
+	_, err = m.Verify(oldToken)
+	require.NoError(t, err)
+	_, err = m.Verify(newToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	server.setKeys(rsaJWK("new", &newKey.PublicKey))
+	require.NoError(t, m.RefreshKeys(context.Background()))
+
+	_, err = m.Verify(newToken)
+	require.NoError(t, err)
+	_, err = m.Verify(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// при недоступном источнике остаются загруженные ранее ключи
+	server.Close()
+	assert.Error(t, m.RefreshKeys(context.Background()))
+	_, err = m.Verify(newToken)
+	require.NoError(t, err)
+}
+
+func TestPEMFilesSource(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "ec-key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	m := newTestManager(t, WithKeySources(NewPEMFilesSource(path)))
+
+	// единственный ключ используется и для токенов без kid
+	_, err = m.Verify(signWithKid(t, jwt.SigningMethodES256, "", ecKey))
+	require.NoError(t, err)
+	_, err = m.Verify(signWithKid(t, jwt.SigningMethodES256, "ec-key", ecKey))
+	require.NoError(t, err)
+
+	_, err = NewJWTManager(testKey, WithKeySources(NewPEMFilesSource(filepath.Join(t.TempDir(), "missing.pem"))))
+	assert.Error(t, err)
+}
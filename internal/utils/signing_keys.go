@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SigningKey is a secret of HS256 tokens identified by kid.
+type SigningKey struct {
+	Kid    string `json:"kid"`
+	Secret string `json:"secret"`
+}
+
+// SigningKeySet is a set of keys accepted for HS256 tokens, new tokens are signed with the current one.
+//
+// Example of key set file:
+//
+//	{"current_kid": "2024-05", "keys": [{"kid": "2024-05", "secret": "..."}, {"kid": "2024-04", "secret": "..."}]}
+type SigningKeySet struct {
+	CurrentKid string       `json:"current_kid"`
+	Keys       []SigningKey `json:"keys"`
+}
+
+// LoadSigningKeySet reads and validates key set from JSON file.
+func LoadSigningKeySet(path string) (*SigningKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read signing keys file: %w", err)
+	}
+	set := &SigningKeySet{}
+	if err = json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("couldn't parse signing keys file: %w", err)
+	}
+	if err = set.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid signing keys file: %w", err)
+	}
+	return set, nil
+}
+
+func (s *SigningKeySet) Validate() error {
+	if len(s.Keys) == 0 {
+		return errors.New("no keys")
+	}
+	kids := make(map[string]struct{}, len(s.Keys))
+	for _, key := range s.Keys {
+		if key.Kid == "" {
+			return errors.New("key has empty kid")
+		}
+		if key.Secret == "" {
+			return fmt.Errorf("key %q has empty secret", key.Kid)
+		}
+		if _, ok := kids[key.Kid]; ok {
+			return fmt.Errorf("duplicate kid %q", key.Kid)
+		}
+		kids[key.Kid] = struct{}{}
+	}
+	if _, ok := kids[s.CurrentKid]; !ok {
+		return fmt.Errorf("current kid %q is not in keys", s.CurrentKid)
+	}
+	return nil
+}
+
+func (s *SigningKeySet) secrets() map[string][]byte {
+	secrets := make(map[string][]byte, len(s.Keys))
+	for _, key := range s.Keys {
+		secrets[key.Kid] = []byte(key.Secret)
+	}
+	return secrets
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSigningKeys(t *testing.T, path string, set SigningKeySet, modTime time.Time) {
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	// время изменения задается явно, чтобы не зависеть от точности часов файловой системы
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func tokenKid(t *testing.T, token string) string {
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &UserClaims{})
+	require.NoError(t, err)
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestJWTManagerSigningKeysRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing-keys.json")
+	writeSigningKeys(t, path, SigningKeySet{
+		CurrentKid: "old",
+		Keys:       []SigningKey{{Kid: "old", Secret: "old-secret"}},
+	}, testNow)
+
+	m := newTestManager(t, WithSigningKeysFile(path))
+
+	oldToken, err := m.Generate("user")
+	require.NoError(t, err)
+	assert.Equal(t, "old", tokenKid(t, oldToken))
+
+	// новый ключ становится текущим, старый остается для проверки выданных токенов
+	writeSigningKeys(t, path, SigningKeySet{
+		CurrentKid: "new",
+		Keys:       []SigningKey{{Kid: "new", Secret: "new-secret"}, {Kid: "old", Secret: "old-secret"}},
+	}, testNow.Add(time.Minute))
+	require.NoError(t, m.ReloadSigningKeys())
+
+	newToken, err := m.Generate("user")
+	require.NoError(t, err)
+	assert.Equal(t, "new", tokenKid(t, newToken))
+
+	for _, token := range []string{oldToken, newToken} {
+		claims, err := m.Verify(token)
+		require.NoError(t, err)
+		assert.Equal(t, "user", claims.Role)
+	}
+
+	// токены без kid не принимаются, если ключей несколько
+	_, err = m.Verify(signHS256(t, validClaims(), "old-secret"))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// после удаления старого ключа его токены больше не принимаются
+	writeSigningKeys(t, path, SigningKeySet{
+		CurrentKid: "new",
+		Keys:       []SigningKey{{Kid: "new", Secret: "new-secret"}},
+	}, testNow.Add(2*time.Minute))
+	require.NoError(t, m.ReloadSigningKeys())
+
+	_, err = m.Verify(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = m.Verify(newToken)
+	require.NoError(t, err)
+
+	// при некорректном файле остаются прежние ключи
+	writeSigningKeys(t, path, SigningKeySet{
+		CurrentKid: "missing",
+		Keys:       []SigningKey{{Kid: "other", Secret: "other-secret"}},
+	}, testNow.Add(3*time.Minute))
+	assert.Error(t, m.ReloadSigningKeys())
+	_, err = m.Verify(newToken)
+	require.NoError(t, err)
+}
+
+func TestJWTManagerWatchesSigningKeysFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing-keys.json")
+	writeSigningKeys(t, path, SigningKeySet{
+		CurrentKid: "old",
+		Keys:       []SigningKey{{Kid: "old", Secret: "old-secret"}},
+	}, testNow)
+
+	m := newTestManager(t, WithSigningKeysFile(path), WithKeysWatchInterval(10*time.Millisecond))
+	go m.RunKeysRefresh()
+	defer m.Stop()
+
+	writeSigningKeys(t, path, SigningKeySet{
+		CurrentKid: "new",
+		Keys:       []SigningKey{{Kid: "new", Secret: "new-secret"}, {Kid: "old", Secret: "old-secret"}},
+	}, testNow.Add(time.Minute))
+
+	require.Eventually(t, func() bool {
+		token, err := m.Generate("user")
+		if err != nil {
+			return false
+		}
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, &UserClaims{})
+		return err == nil && parsed.Header["kid"] == "new"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSigningKeySetValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		set  SigningKeySet
+	}{
+		{name: "no keys", set: SigningKeySet{}},
+		{name: "empty kid", set: SigningKeySet{Keys: []SigningKey{{Secret: "secret"}}}},
+		{name: "empty secret", set: SigningKeySet{CurrentKid: "a", Keys: []SigningKey{{Kid: "a"}}}},
+		{
+			name: "duplicate kid",
+			set:  SigningKeySet{CurrentKid: "a", Keys: []SigningKey{{Kid: "a", Secret: "1"}, {Kid: "a", Secret: "2"}}},
+		},
+		{name: "unknown current kid", set: SigningKeySet{CurrentKid: "b", Keys: []SigningKey{{Kid: "a", Secret: "1"}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Error(t, test.set.Validate())
+		})
+	}
+}
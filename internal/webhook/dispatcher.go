@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+	"github.com/unbeman/av-banner-task/internal/storage"
+)
+
+// Webhook request headers.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+const batchSize = 100
+
+type DispatcherConfig struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+}
+
+// Dispatcher delivers banner events from outbox to subscribed webhooks, failed deliveries are retried with backoff.
+type Dispatcher struct {
+	outbox storage.WebhookOutbox
+	client *http.Client
+	config DispatcherConfig
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewDispatcher(outbox storage.WebhookOutbox, config DispatcherConfig) *Dispatcher {
+	return &Dispatcher{
+		outbox: outbox,
+		client: &http.Client{Timeout: config.Timeout},
+		config: config,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run processes outbox until Stop is called.
+func (d *Dispatcher) Run() {
+	log.Info("starting webhook dispatcher")
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.process(context.Background())
+
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop waits current deliveries to finish and stops dispatcher.
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	<-d.done
+	log.Info("webhook dispatcher stopped")
+}
+
+func (d *Dispatcher) process(ctx context.Context) {
+	if _, err := d.outbox.DispatchWebhookEvents(ctx, batchSize); err != nil {
+		log.Errorf("couldn't dispatch webhook events: %v", err)
+		return
+	}
+
+	// при потере диспетчера доставки станут доступны другим после истечения lease
+	deliveries, err := d.outbox.ClaimWebhookDeliveries(ctx, batchSize, 2*d.config.Timeout)
+	if err != nil {
+		log.Errorf("couldn't claim webhook deliveries: %v", err)
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	responseCode, err := d.send(ctx, delivery)
+	if responseCode != 0 {
+		delivery.ResponseCode = &responseCode
+	}
+
+	var retryIn time.Duration
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = nil
+	case delivery.Attempts >= d.config.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		errText := err.Error()
+		delivery.LastError = &errText
+		log.Warnf("webhook delivery %d failed after %d attempts: %v", delivery.Id, delivery.Attempts, err)
+	default:
+		delivery.Status = models.DeliveryPending
+		errText := err.Error()
+		delivery.LastError = &errText
+		retryIn = Backoff(delivery.Attempts, d.config.BackoffBase, d.config.BackoffMax)
+	}
+
+	if err = d.outbox.UpdateWebhookDelivery(ctx, delivery, retryIn); err != nil {
+		log.Errorf("couldn't save webhook delivery %d result: %v", delivery.Id, err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(models.WebhookPayload{
+		DeliveryId: delivery.Id,
+		EventId:    delivery.EventId,
+		Event:      delivery.Event,
+		OccurredAt: delivery.EventCreatedAt,
+		Banner:     delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't marshal webhook payload: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("couldn't create webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, strconv.Itoa(delivery.Id))
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		// URL подписчика может содержать токен, поэтому не попадает в лог и ошибку доставки
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("couldn't send webhook request: %w", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// Sign returns HMAC-SHA256 signature of webhook body in form "sha256=<hex>".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns delay before the next attempt: base * 2^(attempts-1), limited by maxDelay.
+func Backoff(attempts int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return min(delay, maxDelay)
+}
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/unbeman/av-banner-task/internal/models"
+)
+
+type deliveryResult struct {
+	delivery models.WebhookDelivery
+	retryIn  time.Duration
+}
+
+type fakeOutbox struct {
+	mu         sync.Mutex
+	deliveries models.WebhookDeliveries
+	results    map[int]deliveryResult
+}
+
+func (o *fakeOutbox) DispatchWebhookEvents(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+func (o *fakeOutbox) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (models.WebhookDeliveries, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	claimed := o.deliveries
+	o.deliveries = nil
+	for _, delivery := range claimed {
+		delivery.Attempts++
+	}
+	return claimed, nil
+}
+
+func (o *fakeOutbox) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery, retryIn time.Duration) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.results[delivery.Id] = deliveryResult{delivery: *delivery, retryIn: retryIn}
+	return nil
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	const secret = "webhook-secret"
+
+	var received []*http.Request
+	var receivedBodies [][]byte
+	mu := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		mu.Lock()
+		received = append(received, request)
+		receivedBodies = append(receivedBodies, body)
+		mu.Unlock()
+		if request.URL.Path == "/fail" {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	banner := json.RawMessage(`{"banner_id":1,"feature_id":2,"tag_ids":[3]}`)
+	outbox := &fakeOutbox{
+		deliveries: models.WebhookDeliveries{
+			{Id: 1, EventId: 10, Event: models.BannerCreated, URL: server.URL + "/ok", Secret: secret, Payload: banner},
+			{Id: 2, EventId: 10, Event: models.BannerCreated, URL: server.URL + "/fail", Secret: secret, Payload: banner, Attempts: 1},
+			{Id: 3, EventId: 10, Event: models.BannerCreated, URL: server.URL + "/fail", Secret: secret, Payload: banner, Attempts: 2},
+		},
+		results: make(map[int]deliveryResult),
+	}
+
+	dispatcher := NewDispatcher(outbox, DispatcherConfig{
+		PollInterval: time.Second,
+		Timeout:      time.Second,
+		MaxAttempts:  3,
+		BackoffBase:  time.Second,
+		BackoffMax:   time.Minute,
+	})
+	dispatcher.process(context.Background())
+
+	require.Len(t, received, 3)
+	for i, request := range received {
+		assert.Equal(t, models.BannerCreated, request.Header.Get(EventHeader))
+		assert.Equal(t, Sign(secret, receivedBodies[i]), request.Header.Get(SignatureHeader))
+	}
+
+	delivered := outbox.results[1]
+	assert.Equal(t, models.DeliveryDelivered, delivered.delivery.Status)
+	assert.Equal(t, http.StatusOK, *delivered.delivery.ResponseCode)
+	assert.Nil(t, delivered.delivery.LastError)
+
+	retried := outbox.results[2]
+	assert.Equal(t, models.DeliveryPending, retried.delivery.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, *retried.delivery.ResponseCode)
+	assert.NotNil(t, retried.delivery.LastError)
+	assert.Equal(t, 2*time.Second, retried.retryIn)
+
+	failed := outbox.results[3]
+	assert.Equal(t, models.DeliveryFailed, failed.delivery.Status)
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 2, expected: 2 * time.Second},
+		{attempts: 4, expected: 8 * time.Second},
+		{attempts: 10, expected: time.Minute},
+		{attempts: 100, expected: time.Minute},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Backoff(test.attempts, time.Second, time.Minute), "attempts %d", test.attempts)
+	}
+}
@@ -0,0 +1 @@
+drop table if exists banner_change;
@@ -0,0 +1,11 @@
+create table if not exists banner_change
+(
+    id         bigserial
+        constraint banner_change_pk
+            primary key,
+    event      varchar                             not null,
+    banner_id  integer                             not null,
+    feature_id integer                             not null,
+    tag_ids    integer[]                           not null,
+    created_at timestamp default CURRENT_TIMESTAMP not null
+);
@@ -0,0 +1,5 @@
+drop table if exists webhook_delivery;
+
+drop table if exists webhook;
+
+drop table if exists banner_outbox;
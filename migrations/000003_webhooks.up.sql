@@ -0,0 +1,54 @@
+create table if not exists banner_outbox
+(
+    id                     bigserial
+        constraint banner_outbox_pk
+            primary key,
+    event                  varchar                             not null,
+    banner_id              integer                             not null,
+    payload                jsonb                               not null,
+    created_at             timestamp default CURRENT_TIMESTAMP not null,
+    webhooks_dispatched_at timestamp
+);
+
+create index if not exists banner_outbox_webhooks_pending_index
+    on banner_outbox (id)
+    where webhooks_dispatched_at is null;
+
+create table if not exists webhook
+(
+    id         bigserial
+        constraint webhook_pk
+            primary key,
+    url        varchar                             not null,
+    secret     varchar                             not null,
+    events     varchar[]                           not null,
+    created_at timestamp default CURRENT_TIMESTAMP not null
+);
+
+create table if not exists webhook_delivery
+(
+    id              bigserial
+        constraint webhook_delivery_pk
+            primary key,
+    webhook_id      integer                             not null
+        constraint webhook_delivery_webhook_id_fk
+            references webhook
+            on delete cascade,
+    outbox_id       integer                             not null
+        constraint webhook_delivery_outbox_id_fk
+            references banner_outbox,
+    status          varchar   default 'pending'         not null,
+    attempts        integer   default 0                 not null,
+    response_code   integer,
+    last_error      varchar,
+    next_attempt_at timestamp default CURRENT_TIMESTAMP not null,
+    created_at      timestamp default CURRENT_TIMESTAMP not null,
+    delivered_at    timestamp
+);
+
+create index if not exists webhook_delivery_webhook_id_index
+    on webhook_delivery (webhook_id);
+
+create index if not exists webhook_delivery_pending_index
+    on webhook_delivery (next_attempt_at)
+    where status = 'pending';
@@ -0,0 +1,4 @@
+drop index if exists banner_outbox_publish_pending_index;
+
+alter table banner_outbox
+    drop column if exists published_at;
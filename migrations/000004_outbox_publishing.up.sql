@@ -0,0 +1,6 @@
+alter table banner_outbox
+    add column if not exists published_at timestamp;
+
+create index if not exists banner_outbox_publish_pending_index
+    on banner_outbox (id)
+    where published_at is null;
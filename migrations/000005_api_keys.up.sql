@@ -0,0 +1,17 @@
+create table if not exists api_key
+(
+    id           bigserial
+        constraint api_key_pk
+            primary key,
+    prefix       varchar                             not null,
+    key_hash     varchar                             not null
+        constraint api_key_key_hash_uindex
+            unique,
+    role         varchar                             not null,
+    scopes       varchar[],
+    feature_ids  integer[],
+    description  varchar   default ''                not null,
+    created_at   timestamp default CURRENT_TIMESTAMP not null,
+    last_used_at timestamp,
+    revoked_at   timestamp
+);
@@ -0,0 +1,9 @@
+create table if not exists revoked_token
+(
+    jti        varchar
+        constraint revoked_token_pk
+            primary key,
+    expires_at timestamp,
+    reason     varchar   default ''                not null,
+    revoked_at timestamp default CURRENT_TIMESTAMP not null
+);
@@ -0,0 +1,29 @@
+create table if not exists audit_log
+(
+    id         bigserial
+        constraint audit_log_pk
+            primary key,
+    action     varchar                             not null,
+    banner_id  integer                             not null,
+    actor      varchar                             not null,
+    request_id varchar                             not null,
+    changes    jsonb                               not null,
+    created_at timestamptz default CURRENT_TIMESTAMP not null
+);
+
+create index if not exists audit_log_banner_id_index on audit_log (banner_id);
+create index if not exists audit_log_created_at_index on audit_log (created_at);
+
+-- журнал только дополняется
+create or replace function audit_log_append_only() returns trigger as
+$$
+begin
+    raise exception 'audit_log is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_log_append_only
+    before update or delete or truncate
+    on audit_log
+    for each statement
+execute function audit_log_append_only();
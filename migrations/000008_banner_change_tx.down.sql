@@ -0,0 +1,2 @@
+drop index if exists banner_change_tx_id_index;
+alter table banner_change drop column if exists tx_id;
@@ -0,0 +1,5 @@
+-- поток изменений читается по порядку транзакций, а не по id, который выдается до коммита
+alter table banner_change
+    add column if not exists tx_id bigint default (pg_current_xact_id()::text)::bigint not null;
+
+create index if not exists banner_change_tx_id_index on banner_change (tx_id, id);
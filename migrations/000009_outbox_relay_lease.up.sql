@@ -0,0 +1,11 @@
+-- relay публикует события вне транзакции, аренда не дает другим экземплярам публиковать те же события
+create table if not exists outbox_relay_lease
+(
+    id         boolean default true not null
+        constraint outbox_relay_lease_pk
+            primary key
+        constraint outbox_relay_lease_single
+            check (id),
+    holder     varchar              not null,
+    expires_at timestamptz          not null
+);